@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+)
+
+// The authenticated caller of a request, resolved from its JWT token
+type Principal struct {
+	User 		database.User
+	TokenID 	string
+	IssuedAt 	time.Time
+	ExpiresAt 	time.Time
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// Returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// Returns the principal attached by the validation middleware, if any
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// Returns the authenticated user, if any
+func UserFrom(ctx context.Context) (database.User, bool) {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return database.User{}, false
+	}
+	return p.User, true
+}
+
+// Returns the authenticated user's ID, or 0 for anonymous requests
+func UserID(ctx context.Context) int {
+	if p, ok := PrincipalFrom(ctx); ok {
+		return p.User.ID
+	}
+	return 0
+}
+
+// Returns the authenticated user's username, or "" for anonymous requests
+func Username(ctx context.Context) string {
+	if p, ok := PrincipalFrom(ctx); ok {
+		return p.User.Username
+	}
+	return ""
+}
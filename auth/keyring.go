@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/Nagoogin/munch-bunch-rest-api/config"
+)
+
+// A single signing key. Keys without signing material are verify-only, which
+// is how a retired key keeps its tokens valid until they expire
+type Key struct {
+	ID 			string
+	method 		jwt.SigningMethod
+	signKey 	interface{}
+	verifyKey 	interface{}
+}
+
+// A set of keys identified by kid, one of which signs new tokens
+type Keyring struct {
+	keys 	map[string]*Key
+	active 	*Key
+}
+
+type JWK struct {
+	Kty 	string 	`json:"kty"`
+	Kid 	string 	`json:"kid"`
+	Use 	string 	`json:"use"`
+	Alg 	string 	`json:"alg"`
+	N 		string 	`json:"n,omitempty"`
+	E 		string 	`json:"e,omitempty"`
+	Crv 	string 	`json:"crv,omitempty"`
+	X 		string 	`json:"x,omitempty"`
+	Y 		string 	`json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys 	[]JWK 	`json:"keys"`
+}
+
+// Creates a key for the algorithm. signKey may be nil for a verify-only key;
+// for HMAC the secret is used for both
+func NewKey(id, algorithm string, signKey, verifyKey interface{}) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key id is required")
+	}
+
+	k := &Key{ID: id, signKey: signKey, verifyKey: verifyKey}
+	switch algorithm {
+	case "HS256":
+		k.method = jwt.SigningMethodHS256
+		if _, ok := verifyKey.([]byte); !ok {
+			return nil, fmt.Errorf("key %s: HS256 needs a []byte secret", id)
+		}
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		if _, ok := verifyKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("key %s: RS256 needs an RSA key", id)
+		}
+	case "ES256":
+		k.method = jwt.SigningMethodES256
+		publicKey, ok := verifyKey.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("key %s: ES256 needs a P-256 ECDSA key", id)
+		}
+	case "EdDSA":
+		k.method = SigningMethodEd25519
+		if _, ok := verifyKey.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("key %s: EdDSA needs an Ed25519 key", id)
+		}
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q", id, algorithm)
+	}
+
+	return k, nil
+}
+
+// Creates a keyring that signs with the key whose ID is active
+func NewKeyring(active string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string]*Key)}
+	for _, k := range keys {
+		if _, ok := kr.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+	}
+
+	kr.active = kr.keys[active]
+	if kr.active == nil {
+		return nil, fmt.Errorf("active key %q is not configured", active)
+	}
+	if kr.active.signKey == nil {
+		return nil, fmt.Errorf("active key %q has no private key to sign with", active)
+	}
+
+	return kr, nil
+}
+
+// Builds the keyring described by the auth config, reading any PEM files
+func LoadKeyring(cfg config.AuthConfig) (*Keyring, error) {
+	var keys []*Key
+
+	if cfg.SigningKey != "" {
+		k, err := NewKey(config.DefaultKeyID, "HS256", []byte(cfg.SigningKey), []byte(cfg.SigningKey))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	for _, kc := range cfg.Keys {
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return NewKeyring(cfg.ActiveKeyID(), keys...)
+}
+
+func loadKey(kc config.KeyConfig) (*Key, error) {
+	if kc.Algorithm == "HS256" {
+		return NewKey(kc.ID, kc.Algorithm, []byte(kc.Secret), []byte(kc.Secret))
+	}
+
+	if kc.PrivateKeyFile != "" {
+		data, err := ioutil.ReadFile(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", kc.ID, err)
+		}
+		signKey, verifyKey, err := parsePrivateKey(kc.Algorithm, data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", kc.ID, err)
+		}
+		return NewKey(kc.ID, kc.Algorithm, signKey, verifyKey)
+	}
+
+	data, err := ioutil.ReadFile(kc.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %v", kc.ID, err)
+	}
+	verifyKey, err := parsePublicKey(kc.Algorithm, data)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %v", kc.ID, err)
+	}
+	return NewKey(kc.ID, kc.Algorithm, nil, verifyKey)
+}
+
+func parsePrivateKey(algorithm string, data []byte) (interface{}, interface{}, error) {
+	switch algorithm {
+	case "RS256":
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case "ES256":
+		key, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case "EdDSA":
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, nil, errors.New("private key is not PEM encoded")
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("private key is not an Ed25519 key")
+		}
+		return key, key.Public(), nil
+	}
+	return nil, nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
+
+func parsePublicKey(algorithm string, data []byte) (interface{}, error) {
+	switch algorithm {
+	case "RS256":
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	case "ES256":
+		return jwt.ParseECPublicKeyFromPEM(data)
+	case "EdDSA":
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("public key is not PEM encoded")
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an Ed25519 key")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
+
+// Signs the claims with the active key, recording its ID in the kid header
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.active.method, claims)
+	token.Header["kid"] = kr.active.ID
+
+	return token.SignedString(kr.active.signKey)
+}
+
+// jwt.Keyfunc that picks the verification key named by the token's kid header
+func (kr *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = config.DefaultKeyID
+	}
+
+	k, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown signing key %q", kid)
+	}
+
+	// Never let the token choose the algorithm, or an RSA public key could be
+	// used as an HMAC secret
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method %s", token.Method.Alg())
+	}
+
+	return k.verifyKey, nil
+}
+
+// Returns the public half of every asymmetric key, for other services to
+// verify our tokens. HMAC secrets are never published
+func (kr *Keyring) JWKS() JWKS {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		k := kr.keys[id]
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+		switch key := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = jwt.EncodeSegment(key.N.Bytes())
+			jwk.E = jwt.EncodeSegment(big.NewInt(int64(key.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = key.Curve.Params().Name
+			jwk.X = jwt.EncodeSegment(padLeft(key.X.Bytes(), size))
+			jwk.Y = jwt.EncodeSegment(padLeft(key.Y.Bytes(), size))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = jwt.EncodeSegment(key)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/Nagoogin/munch-bunch-rest-api/config"
+)
+
+func sign(t *testing.T, kr *Keyring) string {
+	tokenString, err := kr.Sign(jwt.MapClaims{"username": "User0"})
+	if err != nil {
+		t.Fatalf("Unexpected error signing token '%v'", err)
+	}
+	return tokenString
+}
+
+func verify(kr *Keyring, tokenString string) error {
+	_, err := jwt.Parse(tokenString, kr.Keyfunc)
+	return err
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	oldPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newPublic, newPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	oldKey, err := NewKey("old", "ES256", oldPrivate, &oldPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewKey("new", "EdDSA", newPrivate, newPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := NewKeyring("old", oldKey)
+	oldToken := sign(t, before)
+
+	// Rotate: the old key is kept for verification only
+	retired, _ := NewKey("old", "ES256", nil, &oldPrivate.PublicKey)
+	after, err := NewKeyring("new", retired, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(after, oldToken); err != nil {
+		t.Errorf("Expected a token signed by the retired key to verify. Got '%v'", err)
+	}
+	if err := verify(after, sign(t, after)); err != nil {
+		t.Errorf("Expected a token signed by the new key to verify. Got '%v'", err)
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmMismatch(t *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKey, _ := NewKey("ec", "ES256", private, &private.PublicKey)
+	kr, _ := NewKeyring("ec", ecKey)
+
+	// HS256 token claiming the EC key's kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "User0"})
+	token.Header["kid"] = "ec"
+	tokenString, _ := token.SignedString([]byte("not-the-key"))
+
+	if err := verify(kr, tokenString); err == nil {
+		t.Errorf("Expected a token with the wrong algorithm to be rejected")
+	}
+}
+
+func TestJWKSOmitsSecrets(t *testing.T) {
+	hmacKey, _ := NewKey(config.DefaultKeyID, "HS256", []byte("0123456789abcdef"), []byte("0123456789abcdef"))
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey("ed", "EdDSA", private, public)
+	kr, _ := NewKeyring(config.DefaultKeyID, hmacKey, edKey)
+
+	jwks := kr.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("Expected only the Ed25519 key to be published. Got %d keys", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kid != "ed" || jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Crv != "Ed25519" {
+		t.Errorf("Unexpected JWK %+v", jwks.Keys[0])
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/auth"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+)
+
+// Authorization middleware. These expect ValidateMiddleware to have run
+// first so the caller is in the request context, and are composed in
+// InitializeRoutes, e.g. a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateTruck))
+
+// Only lets through callers holding one of the roles
+func (a *App) RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			u, ok := auth.UserFrom(r.Context())
+			if !ok {
+				respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Authentication required")
+				return
+			}
+			for _, role := range roles {
+				if u.Role == role {
+					next(w, r)
+					return
+				}
+			}
+			respondWithError(w, http.StatusForbidden, constants.ERROR, "Insufficient permissions")
+		}
+	}
+}
+
+// Only lets through the user named by the {id} route variable, or an admin
+func (a *App) RequireSelfOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := auth.UserFrom(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+			return
+		}
+
+		if u.ID != id && !u.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, constants.ERROR, "You may only access your own account")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Only lets through the owner of the truck named by the {id} route
+// variable, or an admin
+func (a *App) RequireTruckOwner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := auth.UserFrom(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+			return
+		}
+
+		t := database.Truck{ID: id}
+		if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		if t.OwnerID != u.ID && !u.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, constants.ERROR, "Only the truck's owner may do that")
+			return
+		}
+		next(w, r)
+	}
+}
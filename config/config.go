@@ -0,0 +1,349 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server 		ServerConfig 	`yaml:"server"`
+	Database 	DatabaseConfig 	`yaml:"database"`
+	Auth 		AuthConfig 		`yaml:"auth"`
+	Trucks 		TrucksConfig 	`yaml:"trucks"`
+	Paging 		PagingConfig 	`yaml:"paging"`
+}
+
+type ServerConfig struct {
+	Addr 	string 	`yaml:"addr"`
+}
+
+type DatabaseConfig struct {
+	Host 				string 			`yaml:"host"`
+	Port 				int 			`yaml:"port"`
+	User 				string 			`yaml:"user"`
+	Password 			string 			`yaml:"password"`
+	Name 				string 			`yaml:"name"`
+	SSLMode 			string 			`yaml:"sslmode"`
+	MaxOpenConns 		int 			`yaml:"maxOpenConns"`
+	MaxIdleConns 		int 			`yaml:"maxIdleConns"`
+	ConnMaxLifetime 	time.Duration 	`yaml:"connMaxLifetime"`
+	// How long a request's database work may take in total before it's
+	// cancelled and answered with a 504
+	QueryTimeout 		time.Duration 	`yaml:"queryTimeout"`
+}
+
+type AuthConfig struct {
+	SigningKey 			string 			`yaml:"signingKey"`
+	Keys 				[]KeyConfig 	`yaml:"keys"`
+	ActiveKey 			string 			`yaml:"activeKey"`
+	AccessTokenTTL 		time.Duration 	`yaml:"accessTokenTTL"`
+	RefreshTokenTTL 	time.Duration 	`yaml:"refreshTokenTTL"`
+}
+
+type TrucksConfig struct {
+	// How long a truck's last reported location counts as current
+	LocationStaleAfter 	time.Duration 	`yaml:"locationStaleAfter"`
+}
+
+// Page sizes of list endpoints. A count above MaxPageSize is rejected
+type PagingConfig struct {
+	DefaultPageSize 	int 	`yaml:"defaultPageSize"`
+	MaxPageSize 		int 	`yaml:"maxPageSize"`
+}
+
+// A JWT signing key. HS256 keys carry their secret inline; asymmetric keys
+// are read from PEM files, and a key with only a public key file can verify
+// but not sign, which is how a rotated-out key is kept around
+type KeyConfig struct {
+	ID 				string 	`yaml:"id"`
+	Algorithm 		string 	`yaml:"algorithm"`
+	Secret 			string 	`yaml:"secret"`
+	PrivateKeyFile 	string 	`yaml:"privateKeyFile"`
+	PublicKeyFile 	string 	`yaml:"publicKeyFile"`
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+var signingAlgorithms = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+// Key ID given to the HMAC key built from auth.signingKey, and assumed for
+// tokens issued before tokens carried a kid header
+const DefaultKeyID = "default"
+
+// Returns a config populated with the defaults for every optional setting
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr: ":8080",
+		},
+		Database: DatabaseConfig{
+			Host: "localhost",
+			Port: 5432,
+			SSLMode: "disable",
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+			ConnMaxLifetime: 30 * time.Minute,
+			QueryTimeout: 5 * time.Second,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL: 15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Trucks: TrucksConfig{
+			LocationStaleAfter: 30 * time.Minute,
+		},
+		Paging: PagingConfig{
+			DefaultPageSize: 10,
+			MaxPageSize: 50,
+		},
+	}
+}
+
+// Loads the config from the defaults, then the YAML file at path if one is
+// given, then environment variables, and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: reading %s: %v", path, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("config: parsing %s: %v", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Overrides settings with any environment variables that are set
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []string
+
+	str := func(name string, dst *string) {
+		if v, ok := lookup(name); ok {
+			*dst = v
+		}
+	}
+	num := func(name string, dst *int) {
+		if v, ok := lookup(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an integer", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(name string, dst *time.Duration) {
+		if v, ok := lookup(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a duration (e.g. 15m, 720h)", name, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("APP_LISTEN_ADDR", &c.Server.Addr)
+
+	str("APP_DB_HOST", &c.Database.Host)
+	num("APP_DB_PORT", &c.Database.Port)
+	str("APP_DB_USERNAME", &c.Database.User)
+	str("APP_DB_PASSWORD", &c.Database.Password)
+	str("APP_DB_NAME", &c.Database.Name)
+	str("APP_DB_SSLMODE", &c.Database.SSLMode)
+	num("APP_DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	num("APP_DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	dur("APP_DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	dur("APP_DB_QUERY_TIMEOUT", &c.Database.QueryTimeout)
+
+	str("APP_JWT_SECRET", &c.Auth.SigningKey)
+	str("APP_JWT_ACTIVE_KEY", &c.Auth.ActiveKey)
+	dur("APP_ACCESS_TOKEN_TTL", &c.Auth.AccessTokenTTL)
+	dur("APP_REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL)
+
+	dur("APP_LOCATION_STALE_AFTER", &c.Trucks.LocationStaleAfter)
+
+	num("APP_DEFAULT_PAGE_SIZE", &c.Paging.DefaultPageSize)
+	num("APP_MAX_PAGE_SIZE", &c.Paging.MaxPageSize)
+
+	if len(errs) > 0 {
+		return errors.New("config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Checks the config for missing or out of range settings, reporting every
+// problem found rather than just the first
+func (c *Config) Validate() error {
+	var errs []string
+
+	if c.Server.Addr == "" {
+		errs = append(errs, "server.addr is required")
+	}
+
+	if c.Database.Host == "" {
+		errs = append(errs, "database.host is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("database.port must be between 1 and 65535, got %d", c.Database.Port))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, "database.user is required (APP_DB_USERNAME)")
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, "database.name is required (APP_DB_NAME)")
+	}
+	if !contains(sslModes, c.Database.SSLMode) {
+		errs = append(errs, fmt.Sprintf("database.sslmode must be one of %s, got %q", strings.Join(sslModes, ", "), c.Database.SSLMode))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, fmt.Sprintf("database.maxOpenConns must be at least 1, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Sprintf("database.maxIdleConns must be between 0 and maxOpenConns (%d), got %d", c.Database.MaxOpenConns, c.Database.MaxIdleConns))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, "database.connMaxLifetime must not be negative")
+	}
+	if c.Database.QueryTimeout <= 0 {
+		errs = append(errs, "database.queryTimeout must be positive")
+	}
+
+	errs = append(errs, c.Auth.validateKeys()...)
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, "auth.accessTokenTTL must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		errs = append(errs, "auth.refreshTokenTTL must be longer than auth.accessTokenTTL")
+	}
+
+	if c.Trucks.LocationStaleAfter <= 0 {
+		errs = append(errs, "trucks.locationStaleAfter must be positive")
+	}
+
+	if c.Paging.DefaultPageSize < 1 {
+		errs = append(errs, fmt.Sprintf("paging.defaultPageSize must be at least 1, got %d", c.Paging.DefaultPageSize))
+	}
+	if c.Paging.MaxPageSize < c.Paging.DefaultPageSize {
+		errs = append(errs, fmt.Sprintf("paging.maxPageSize must be at least defaultPageSize (%d), got %d", c.Paging.DefaultPageSize, c.Paging.MaxPageSize))
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (a AuthConfig) validateKeys() []string {
+	var errs []string
+
+	if a.SigningKey == "" && len(a.Keys) == 0 {
+		return []string{"auth.signingKey (APP_JWT_SECRET) or auth.keys is required"}
+	}
+	if a.SigningKey != "" && len(a.SigningKey) < 16 {
+		errs = append(errs, "auth.signingKey must be at least 16 characters (APP_JWT_SECRET)")
+	}
+
+	ids := map[string]bool{}
+	if a.SigningKey != "" {
+		ids[DefaultKeyID] = true
+	}
+	for i, k := range a.Keys {
+		field := fmt.Sprintf("auth.keys[%d]", i)
+		if k.ID == "" {
+			errs = append(errs, field + ".id is required")
+		} else if ids[k.ID] {
+			errs = append(errs, fmt.Sprintf("%s.id %q is used by another key", field, k.ID))
+		}
+		ids[k.ID] = true
+
+		if !contains(signingAlgorithms, k.Algorithm) {
+			errs = append(errs, fmt.Sprintf("%s.algorithm must be one of %s, got %q", field, strings.Join(signingAlgorithms, ", "), k.Algorithm))
+			continue
+		}
+		if k.Algorithm == "HS256" {
+			if len(k.Secret) < 16 {
+				errs = append(errs, field + ".secret must be at least 16 characters")
+			}
+		} else if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+			errs = append(errs, field + " needs a privateKeyFile or publicKeyFile")
+		}
+	}
+
+	active := a.ActiveKeyID()
+	if active == "" {
+		errs = append(errs, "auth.activeKey is required when more than one key is configured")
+	} else if !ids[active] {
+		errs = append(errs, fmt.Sprintf("auth.activeKey %q does not match any configured key", active))
+	}
+	for _, k := range a.Keys {
+		if k.ID == active && k.Algorithm != "HS256" && k.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Sprintf("auth.activeKey %q needs a privateKeyFile to sign tokens", active))
+		}
+	}
+
+	return errs
+}
+
+// Returns the ID of the key that signs new tokens. Without an explicit
+// activeKey, a lone configured key is used
+func (a AuthConfig) ActiveKeyID() string {
+	if a.ActiveKey != "" {
+		return a.ActiveKey
+	}
+	if len(a.Keys) == 0 && a.SigningKey != "" {
+		return DefaultKeyID
+	}
+	if len(a.Keys) == 1 && a.SigningKey == "" {
+		return a.Keys[0].ID
+	}
+	return ""
+}
+
+// Returns the lib/pq connection string for the database settings
+func (d DatabaseConfig) DSN() string {
+	params := []struct{ key, value string }{
+		{"host", d.Host},
+		{"port", strconv.Itoa(d.Port)},
+		{"user", d.User},
+		{"password", d.Password},
+		{"dbname", d.Name},
+		{"sslmode", d.SSLMode},
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		value := strings.Replace(p.value, `\`, `\\`, -1)
+		value = strings.Replace(value, `'`, `\'`, -1)
+		parts = append(parts, fmt.Sprintf("%s='%s'", p.key, value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	cfg := Default()
+	cfg.Database.User = "munchbunch"
+	cfg.Database.Name = "munchbunch"
+	cfg.Auth.SigningKey = "0123456789abcdef"
+	return cfg
+}
+
+func TestValidateDefaults(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Errorf("Expected a valid config. Got '%v'", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Database.Port = 0
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.QueryTimeout = 0
+	cfg.Auth.SigningKey = "short"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected the config to be invalid")
+	}
+	for _, field := range []string{"database.port", "database.sslmode", "database.queryTimeout", "auth.signingKey"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected the error to mention %s. Got '%v'", field, err)
+		}
+	}
+}
+
+func TestValidateKeys(t *testing.T) {
+	cfg := validConfig()
+	cfg.Auth.Keys = []KeyConfig{
+		{ID: "2024-rsa", Algorithm: "RS256", PublicKeyFile: "old.pub.pem"},
+		{ID: "2025-ed", Algorithm: "EdDSA", PrivateKeyFile: "new.pem"},
+	}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "auth.activeKey is required") {
+		t.Errorf("Expected an error asking for auth.activeKey. Got '%v'", err)
+	}
+
+	cfg.Auth.ActiveKey = "2024-rsa"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "needs a privateKeyFile") {
+		t.Errorf("Expected an error about signing with a verify-only key. Got '%v'", err)
+	}
+
+	cfg.Auth.ActiveKey = "2025-ed"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config. Got '%v'", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"APP_LISTEN_ADDR": ":9090",
+		"APP_DB_PORT": "6543",
+		"APP_ACCESS_TOKEN_TTL": "5m",
+		"APP_LOCATION_STALE_AFTER": "10m",
+		"APP_MAX_PAGE_SIZE": "100",
+		"APP_DB_QUERY_TIMEOUT": "2s",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := validConfig()
+	if err := cfg.applyEnv(lookup); err != nil {
+		t.Fatalf("Unexpected error '%v'", err)
+	}
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("Expected addr to be ':9090'. Got '%s'", cfg.Server.Addr)
+	}
+	if cfg.Database.Port != 6543 {
+		t.Errorf("Expected port to be 6543. Got %d", cfg.Database.Port)
+	}
+	if cfg.Auth.AccessTokenTTL != 5*time.Minute {
+		t.Errorf("Expected access token TTL to be 5m. Got %v", cfg.Auth.AccessTokenTTL)
+	}
+	if cfg.Trucks.LocationStaleAfter != 10*time.Minute {
+		t.Errorf("Expected the stale location threshold to be 10m. Got %v", cfg.Trucks.LocationStaleAfter)
+	}
+	if cfg.Paging.MaxPageSize != 100 {
+		t.Errorf("Expected the max page size to be 100. Got %d", cfg.Paging.MaxPageSize)
+	}
+	if cfg.Database.QueryTimeout != 2*time.Second {
+		t.Errorf("Expected the query timeout to be 2s. Got %v", cfg.Database.QueryTimeout)
+	}
+
+	env["APP_DB_PORT"] = "five"
+	if err := cfg.applyEnv(lookup); err == nil || !strings.Contains(err.Error(), "APP_DB_PORT") {
+		t.Errorf("Expected an error naming APP_DB_PORT. Got '%v'", err)
+	}
+}
+
+func TestDSNQuotesValues(t *testing.T) {
+	cfg := validConfig()
+	cfg.Database.Password = "it's secret"
+
+	dsn := cfg.Database.DSN()
+	if !strings.Contains(dsn, `password='it\'s secret'`) {
+		t.Errorf("Expected the password to be quoted. Got '%s'", dsn)
+	}
+}
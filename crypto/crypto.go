@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"golang.org/x/crypto/bcrypt"	
 )
@@ -25,4 +28,18 @@ func ComparePasswords(hash string, password []byte) bool {
 	}
 	return true
 }
+// Generate a random hex encoded string from n bytes of entropy
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
 
+// Hash an opaque token for storage. Tokens are high entropy, so a fast
+// unsalted digest is enough and keeps them searchable
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
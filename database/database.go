@@ -1,125 +1,554 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
 )
 
-type UserCredentials struct {
-	Username 	string 	`json:"username"`
-	Password	string	`json:"password"`
-}
+const (
+	RoleCustomer 	= "customer"
+	RoleTruckOwner 	= "truck_owner"
+	RoleAdmin 		= "admin"
+)
 
+// A row of the users table. Handlers respond with model.User instead, so the
+// hash never leaves the server
 type User struct {
 	ID 			int 	`json:"id"`
 	Username 	string 	`json:"username"`
-	Hash		string	`json:"hash"`
+	Hash		string	`json:"-"`
 	Fname		string	`json:"fname"`
 	Lname		string	`json:"lname"`
 	Email		string	`json:"email"`
+	Cell		string	`json:"cell"`
 	HasTruck	bool	`json:"hasTruck"`
+	Role		string	`json:"role"`
 }
 
 type Truck struct {
-	ID		int		`json:"id"`
-	Name 	string 	`json:"name"`
-	// Cell	string	`json:"cell"`
-	// Address string 	`json:"address"`
-	// City	string 	`json:"city"`
-	// State	string	`json:"state"`
-	// Zip		string	`json:"zip"`
-	// Locate	bool	`json:"locate"`
-	// Location struct	`json:"location"`
+	ID				int							`json:"id"`
+	Name 			string 						`json:"name"`
+	OwnerID			int							`json:"ownerId"`
+	Cell			string						`json:"cell"`
+	Address 		string 						`json:"address"`
+	City			string 						`json:"city"`
+	State			string						`json:"state"`
+	Zip				string						`json:"zip"`
+	Description 	string 						`json:"description"`
+	Cuisines 		[]string 					`json:"cuisines"`
+	Website 		string 						`json:"website"`
+	SocialLinks 	map[string]string 			`json:"socialLinks"`
+	// IANA zone the opening hours are in
+	Timezone 		string 						`json:"timezone"`
+	Hours 			[]domain.Hours 				`json:"hours"`
+	HoursExceptions []domain.HoursException 	`json:"hoursExceptions"`
+	// Average review score and the number of reviews behind it
+	Rating 			float64 					`json:"rating"`
+	RatingCount 	int 						`json:"ratingCount"`
+	// How many users follow the truck
+	FavoriteCount 	int 						`json:"favoriteCount"`
+	ScheduleSlots 	[]ScheduleSlot 				`json:"scheduleSlots"`
+	// Only the events that haven't ended yet
+	Events 			[]ScheduleEvent 			`json:"events"`
+	// The last location the truck reported, nil if it never has
+	Location 		*Location 					`json:"location"`
+}
+
+// A reported position. Accuracy is in meters, zero when unknown
+type Location struct {
+	Latitude 	float64 	`json:"lat"`
+	Longitude 	float64 	`json:"lng"`
+	Accuracy 	float64 	`json:"accuracy"`
+	RecordedAt 	time.Time 	`json:"recordedAt"`
 }
 
 type JsonRsp struct {
-	Code 	int 		`json:"code"`
-	Status	string		`json:"status"`
-	Message	string		`json:"message"`
-	Data 	interface{}	`json:"data"`
+	Code 		int 		`json:"code"`
+	Status		string		`json:"status"`
+	// What went wrong, stable for clients to match on. Only set on errors
+	ErrorCode 	string 		`json:"errorCode,omitempty"`
+	Message		string		`json:"message"`
+	Data 		interface{}	`json:"data"`
+	// Cursors to the neighbouring pages of a listing
+	Paging 		*Page 		`json:"paging,omitempty"`
 }
 
-func (u *User) GetUser(db *sql.DB) error {
-	return db.QueryRow("SELECT username, hash, fname, lname, email, hasTruck FROM users WHERE id=$1",
-		u.ID).Scan(&u.Username, &u.Hash, &u.Fname, &u.Lname, &u.Email, &u.HasTruck)
+func (pg *Postgres) GetUser(ctx context.Context, u *User) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT username, hash, fname, lname, email, cell, hasTruck, role FROM users WHERE id=$1",
+		u.ID).Scan(&u.Username, &u.Hash, &u.Fname, &u.Lname, &u.Email, &u.Cell, &u.HasTruck, &u.Role)
+
+	return translate(err, "User")
 }
 
-func (u *User) GetUserByUsername(db *sql.DB) error {
-	return db.QueryRow("SELECT username, hash, fname, lname, email, hasTruck FROM users WHERE username=$1",
-		u.Username).Scan(&u.Username, &u.Hash, &u.Fname, &u.Lname, &u.Email, &u.HasTruck)
+func (pg *Postgres) GetUserByUsername(ctx context.Context, u *User) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT id, username, hash, fname, lname, email, cell, hasTruck, role FROM users WHERE username=$1",
+		u.Username).Scan(&u.ID, &u.Username, &u.Hash, &u.Fname, &u.Lname, &u.Email, &u.Cell, &u.HasTruck, &u.Role)
+
+	return translate(err, "User")
 }
 
-func (u *User) CreateUser(db *sql.DB) error {
-	err := db.QueryRow("INSERT INTO users (username, hash, fname, lname, email, hasTruck) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
-		u.Username, u.Hash, u.Fname, u.Lname, u.Email, u.HasTruck).Scan(&u.ID)
+// Returns a page of users in id order, only those with the role if one is
+// given
+func (pg *Postgres) GetUsers(ctx context.Context, role string, p PageRequest) ([]User, Page, error) {
+	q := listQuery{
+		columns: "id, username, hash, fname, lname, email, cell, hasTruck, role",
+		from: "users",
+		order: keyset{"id", []string{"id"}, false},
+	}
+	if role != "" {
+		q.where = []string{"role=$1"}
+		q.args = []interface{}{role}
+	}
 
+	scanned := []User{}
+	page, err := q.run(ctx, pg.db, p, func(row rowScanner, keys ...interface{}) error {
+		var u User
+		if err := row.Scan(append([]interface{}{&u.ID, &u.Username, &u.Hash, &u.Fname, &u.Lname, &u.Email, &u.Cell, &u.HasTruck, &u.Role}, keys...)...); err != nil {
+			return err
+		}
+		scanned = append(scanned, u)
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, page, err
 	}
 
-	return nil
+	users := make([]User, 0, len(page.rows))
+	for _, i := range page.rows {
+		users = append(users, scanned[i])
+	}
+	return users, page, nil
 }
 
-func (u *User) UpdateUser(db *sql.DB) error {
-	_, err := db.Exec("UPDATE users SET username=$1, hash=$2, fname=$3, lname=$4, email=$5, hasTruck=$6 WHERE id=$7",
-		u.Username, u.Hash, u.Fname, u.Lname, u.Email, u.HasTruck, u.ID)
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
 
-	return err
+func ValidRole(role string) bool {
+	return role == RoleCustomer || role == RoleTruckOwner || role == RoleAdmin
 }
 
-func (u *User) DeleteUser(db *sql.DB) error {
-	_, err := db.Exec("DELETE FROM users WHERE id=$1", u.ID)
+// Reports whether a user other than excludeID already has the given username
+func (pg *Postgres) UsernameExists(ctx context.Context, username string, excludeID int) (bool, error) {
+	var exists bool
+	err := pg.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username=$1 AND id<>$2)",
+		username, excludeID).Scan(&exists)
 
-	return err
+	return exists, err
 }
 
-func (t *Truck) GetTruck(db *sql.DB) error {
-	return db.QueryRow("SELECT name FROM trucks WHERE id=$1", 
-		t.ID).Scan(&t.Name)
+// Reports whether a user other than excludeID already has the given email
+func (pg *Postgres) EmailExists(ctx context.Context, email string, excludeID int) (bool, error) {
+	var exists bool
+	err := pg.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE lower(email)=lower($1) AND id<>$2)",
+		email, excludeID).Scan(&exists)
+
+	return exists, err
 }
 
-func GetTrucks(db *sql.DB, start, count int) ([]Truck, error) { 
-	rows, err := db.Query("SELECT id, name FROM trucks LIMIT $1 OFFSET $2",
-		count, start)
+func (pg *Postgres) CreateUser(ctx context.Context, u *User) error {
+	if u.Role == "" {
+		u.Role = RoleCustomer
+	}
+
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO users (username, hash, fname, lname, email, cell, hasTruck, role) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		u.Username, u.Hash, u.Fname, u.Lname, u.Email, u.Cell, u.HasTruck, u.Role).Scan(&u.ID)
 
+	return translate(err, "")
+}
+
+// Updates everything but the password hash, which only UpdatePassword changes
+func (pg *Postgres) UpdateUser(ctx context.Context, u *User) error {
+	res, err := pg.db.ExecContext(ctx, "UPDATE users SET username=$1, fname=$2, lname=$3, email=$4, cell=$5, hasTruck=$6, role=$7 WHERE id=$8",
+		u.Username, u.Fname, u.Lname, u.Email, u.Cell, u.HasTruck, u.Role, u.ID)
+
+	return affectedRow(res, err, "User")
+}
+
+func (pg *Postgres) UpdatePassword(ctx context.Context, u *User) error {
+	res, err := pg.db.ExecContext(ctx, "UPDATE users SET hash=$1 WHERE id=$2", u.Hash, u.ID)
+
+	return affectedRow(res, err, "User")
+}
+
+func (pg *Postgres) DeleteUser(ctx context.Context, u *User) error {
+	res, err := pg.db.ExecContext(ctx, "DELETE FROM users WHERE id=$1", u.ID)
+
+	return affectedRow(res, err, "User")
+}
+
+// Marks the user as owning a truck, making a customer a truck owner
+func (pg *Postgres) SetHasTruck(ctx context.Context, u *User) error {
+	res, err := pg.db.ExecContext(ctx, "UPDATE users SET hasTruck=true, role=CASE WHEN role=$2 THEN $3 ELSE role END WHERE id=$1",
+		u.ID, RoleCustomer, RoleTruckOwner)
+
+	return affectedRow(res, err, "User")
+}
+
+const truckColumns = "id, name, owner_id, cell, address, city, state, zip, description, cuisines, website, social_links, timezone, rating_avg, rating_count, favorite_count, latitude, longitude, location_accuracy, location_recorded_at"
+
+func (pg *Postgres) GetTruck(ctx context.Context, t *Truck) error {
+	err := scanTruck(pg.db.QueryRowContext(ctx, "SELECT " + truckColumns + " FROM trucks WHERE id=$1", 
+		t.ID), t)
 	if err != nil {
-		return nil, err
+		return translate(err, "Truck")
 	}
 
-	defer rows.Close()
+	return loadTruckDetails(ctx, pg.db, []*Truck{t})
+}
 
-	trucks := []Truck{}
+// Narrows and orders a trucks listing. Zero values don't filter
+type TruckFilter struct {
+	// Full-text search over the name, cuisines and description
+	Search 		string
+	Cuisine 	string
+	MinRating 	float64
+	// Only trucks open at this time
+	OpenAt 		time.Time
+	// One of TruckSorts, "" for the default order
+	Sort 		string
+}
 
-	for rows.Next() {
+// The orders a trucks listing can be sorted in. Every order ends with the id so
+// a cursor always points between two rows
+var truckSorts = map[string]keyset{
+	"id": {"id", []string{"id"}, false},
+	"name": {"name", []string{"lower(name)", "id"}, false},
+	"-name": {"-name", []string{"lower(name)", "id"}, true},
+	"rating": {"rating", []string{"rating_avg", "rating_count", "id"}, false},
+	"-rating": {"-rating", []string{"rating_avg", "rating_count", "id"}, true},
+	"newest": {"newest", []string{"id"}, true},
+	"relevance": {"relevance", []string{"ts_rank(search_vector, plainto_tsquery('english', $1))", "id"}, true},
+}
+
+func ValidTruckSort(sort string) bool {
+	_, ok := truckSorts[sort]
+	return ok
+}
+
+// The names ValidTruckSort accepts, sorted
+func TruckSorts() []string {
+	names := make([]string, 0, len(truckSorts))
+	for name := range truckSorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Searches sort by relevance unless asked otherwise, everything else by id
+func (f TruckFilter) order() keyset {
+	name := f.Sort
+	if name == "" {
+		name = "id"
+		if f.Search != "" {
+			name = "relevance"
+		}
+	}
+	if name == "relevance" && f.Search == "" {
+		name = "id"
+	}
+	return truckSorts[name]
+}
+
+// The conditions of the filter and their arguments. The search text is
+// always $1 when there is one, which the relevance order relies on
+func (f TruckFilter) where() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.Search != "" {
+		args = append(args, f.Search)
+		conditions = append(conditions, "search_vector @@ plainto_tsquery('english', $1)")
+	}
+	if f.Cuisine != "" {
+		args = append(args, pq.Array([]string{f.Cuisine}))
+		conditions = append(conditions, fmt.Sprintf("cuisines @> $%d", len(args)))
+	}
+	if f.MinRating > 0 {
+		args = append(args, f.MinRating)
+		conditions = append(conditions, fmt.Sprintf("rating_avg >= $%d", len(args)))
+	}
+	return conditions, args
+}
+
+// Returns a page of the trucks matching the filter, in its order
+func (pg *Postgres) GetTrucks(ctx context.Context, f TruckFilter, p PageRequest) ([]Truck, Page, error) {
+	where, args := f.where()
+	q := listQuery{columns: truckColumns, from: "trucks", where: where, args: args, order: f.order()}
+
+	scanned := []Truck{}
+	scan := func(row rowScanner, keys ...interface{}) error {
 		var t Truck
-		if err := rows.Scan(&t.ID, &t.Name); err != nil {
-			return nil, err
+		if err := scanTruck(row, &t, keys...); err != nil {
+			return err
+		}
+		scanned = append(scanned, t)
+		return nil
+	}
+
+	var page Page
+	var err error
+	if f.OpenAt.IsZero() {
+		page, err = q.run(ctx, pg.db, p, scan)
+	} else {
+		// Opening times depend on the hours and schedule, so those are loaded
+		// for every truck read rather than just the ones returned
+		page, err = q.runFiltered(ctx, pg.db, p, scan, func(from, to int) error {
+			return loadTruckDetails(ctx, pg.db, truckPointers(scanned[from:to]))
+		}, func(i int) bool {
+			return scanned[i].Schedule().IsOpen(f.OpenAt)
+		})
+	}
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]Truck, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+	if f.OpenAt.IsZero() {
+		if err := loadTruckDetails(ctx, pg.db, truckPointers(trucks)); err != nil {
+			return nil, page, err
 		}
-		trucks = append(trucks, t)
 	}
 
-	return trucks, nil
+	return trucks, page, nil
 }
 
-func (t *Truck) CreateTruck(db *sql.DB) error {
-	err := db.QueryRow("INSERT INTO trucks (name) VALUES($1) RETURNING id",
-		t.Name).Scan(&t.ID)
+func truckPointers(trucks []Truck) []*Truck {
+	ptrs := make([]*Truck, len(trucks))
+	for i := range trucks {
+		ptrs[i] = &trucks[i]
+	}
+	return ptrs
+}
+
+// Loads what lives outside the trucks table: hours and schedules
+func loadTruckDetails(ctx context.Context, db DBTX, trucks []*Truck) error {
+	if err := loadTruckHours(ctx, db, trucks); err != nil {
+		return err
+	}
+	return loadTruckSchedules(ctx, db, trucks)
+}
 
+// Scans truckColumns into t, followed by any extra columns the query selected
+func scanTruck(row rowScanner, t *Truck, extra ...interface{}) error {
+	var ownerID sql.NullInt64
+	var socialLinks []byte
+	var lat, lng, accuracy sql.NullFloat64
+	var recordedAt sql.NullTime
+	dest := []interface{}{&t.ID, &t.Name, &ownerID, &t.Cell, &t.Address, &t.City, &t.State, &t.Zip, &t.Description,
+		pq.Array(&t.Cuisines), &t.Website, &socialLinks, &t.Timezone, &t.Rating, &t.RatingCount, &t.FavoriteCount, &lat, &lng, &accuracy, &recordedAt}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return err
 	}
+	t.OwnerID = int(ownerID.Int64)
+	t.SocialLinks = map[string]string{}
+	if err := json.Unmarshal(socialLinks, &t.SocialLinks); err != nil {
+		return err
+	}
+	t.Location = nil
+	if recordedAt.Valid {
+		t.Location = &Location{
+			Latitude: lat.Float64,
+			Longitude: lng.Float64,
+			Accuracy: accuracy.Float64,
+			RecordedAt: recordedAt.Time,
+		}
+	}
 
 	return nil
 }
 
-func (t *Truck) UpdateTruck(db *sql.DB) error {
-	_, err := db.Exec("UPDATE trucks SET name=$1 WHERE id=$2",
-		t.Name, t.ID)
+// A truck found by a nearby search, with its distance from the search point
+type TruckDistance struct {
+	Truck
+	DistanceMeters float64
+}
+
+// Returns a page of trucks whose current location, reported after since, is
+// within radius meters of lat,lng, nearest first. The bounding box lets the
+// location index discard most rows before the haversine distance is computed
+func (pg *Postgres) GetTrucksNear(ctx context.Context, lat, lng, radius float64, since time.Time, p PageRequest) ([]TruckDistance, Page, error) {
+	box := domain.BoundsAround(lat, lng, radius)
+	q := listQuery{
+		columns: truckColumns + ", distance",
+		from: `(
+		SELECT ` + truckColumns + `,
+			2 * $3 * asin(least(1, sqrt(
+				power(sin(radians(latitude - $1) / 2), 2) +
+				cos(radians($1)) * cos(radians(latitude)) * power(sin(radians(longitude - $2) / 2), 2)
+			))) AS distance
+		FROM trucks
+		WHERE latitude BETWEEN $4 AND $5 AND longitude BETWEEN $6 AND $7 AND location_recorded_at > $8
+	) nearby`,
+		where: []string{"distance <= $9"},
+		args: []interface{}{lat, lng, domain.EarthRadiusMeters, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng, since, radius},
+		order: keyset{"distance", []string{"distance", "id"}, false},
+	}
+
+	scanned := []TruckDistance{}
+	page, err := q.run(ctx, pg.db, p, func(row rowScanner, keys ...interface{}) error {
+		var t TruckDistance
+		if err := scanTruck(row, &t.Truck, append([]interface{}{&t.DistanceMeters}, keys...)...); err != nil {
+			return err
+		}
+		scanned = append(scanned, t)
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]TruckDistance, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+
+	ptrs := make([]*Truck, len(trucks))
+	for i := range trucks {
+		ptrs[i] = &trucks[i].Truck
+	}
+	if err := loadTruckDetails(ctx, pg.db, ptrs); err != nil {
+		return nil, page, err
+	}
+
+	return trucks, page, nil
+}
+
+// Records a location report in the truck's history and makes it the current
+// location, unless a newer report has already arrived. Returns whether the
+// current location changed
+func (pg *Postgres) RecordLocation(ctx context.Context, t *Truck, loc Location) (moved bool, err error) {
+	err = pg.transact(ctx, func(tx *Postgres) error {
+		moved, err = tx.recordLocation(ctx, t, loc)
+		return err
+	})
+	return moved, err
+}
+
+func (pg *Postgres) recordLocation(ctx context.Context, t *Truck, loc Location) (bool, error) {
+	_, err := pg.db.ExecContext(ctx, "INSERT INTO truck_locations (truck_id, latitude, longitude, accuracy, recorded_at) VALUES($1, $2, $3, $4, $5)",
+		t.ID, loc.Latitude, loc.Longitude, loc.Accuracy, loc.RecordedAt)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := pg.db.ExecContext(ctx, "UPDATE trucks SET latitude=$1, longitude=$2, location_accuracy=$3, location_recorded_at=$4 WHERE id=$5 AND (location_recorded_at IS NULL OR location_recorded_at <= $4)",
+		loc.Latitude, loc.Longitude, loc.Accuracy, loc.RecordedAt, t.ID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		t.Location = &loc
+	}
+
+	return n > 0, nil
+}
+
+// Returns a page of the truck's reported locations, newest first
+func (pg *Postgres) GetTruckLocations(ctx context.Context, truckID int, p PageRequest) ([]Location, Page, error) {
+	q := listQuery{
+		columns: "latitude, longitude, accuracy, recorded_at",
+		from: "truck_locations",
+		where: []string{"truck_id=$1"},
+		args: []interface{}{truckID},
+		order: keyset{"recent", []string{"recorded_at", "id"}, true},
+	}
+
+	scanned := []Location{}
+	page, err := q.run(ctx, pg.db, p, func(row rowScanner, keys ...interface{}) error {
+		var l Location
+		if err := row.Scan(append([]interface{}{&l.Latitude, &l.Longitude, &l.Accuracy, &l.RecordedAt}, keys...)...); err != nil {
+			return err
+		}
+		scanned = append(scanned, l)
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+
+	locations := make([]Location, 0, len(page.rows))
+	for _, i := range page.rows {
+		locations = append(locations, scanned[i])
+	}
+	return locations, page, nil
+}
+
+// Inserts the truck with its profile and opening hours
+func (pg *Postgres) CreateTruck(ctx context.Context, t *Truck) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return tx.createTruck(ctx, t)
+	})
+}
+
+func (pg *Postgres) createTruck(ctx context.Context, t *Truck) error {
+	socialLinks, err := marshalLinks(t.SocialLinks)
+	if err != nil {
+		return err
+	}
+
+	err = pg.db.QueryRowContext(ctx, "INSERT INTO trucks (name, owner_id, cell, address, city, state, zip, description, cuisines, website, social_links, timezone) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id",
+		t.Name, nullableID(t.OwnerID), t.Cell, t.Address, t.City, t.State, t.Zip, t.Description, pq.Array(t.Cuisines), t.Website, socialLinks, t.timezone()).Scan(&t.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return t.saveHours(ctx, pg.db)
+}
+
+// Saves the truck's profile and replaces its opening hours. The location is
+// left alone; it only changes through RecordLocation
+func (pg *Postgres) UpdateTruck(ctx context.Context, t *Truck) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return tx.updateTruck(ctx, t)
+	})
+}
+
+func (pg *Postgres) updateTruck(ctx context.Context, t *Truck) error {
+	socialLinks, err := marshalLinks(t.SocialLinks)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.db.ExecContext(ctx, "UPDATE trucks SET name=$1, owner_id=$2, cell=$3, address=$4, city=$5, state=$6, zip=$7, description=$8, cuisines=$9, website=$10, social_links=$11, timezone=$12 WHERE id=$13",
+		t.Name, nullableID(t.OwnerID), t.Cell, t.Address, t.City, t.State, t.Zip, t.Description, pq.Array(t.Cuisines), t.Website, socialLinks, t.timezone(), t.ID)
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	return t.saveHours(ctx, pg.db)
 }
 
-func (t *Truck) DeleteTruck(db *sql.DB) error {
-	_, err := db.Exec("DELETE FROM trucks WHERE id=$1", t.ID)
+func (pg *Postgres) DeleteTruck(ctx context.Context, t *Truck) error {
+	res, err := pg.db.ExecContext(ctx, "DELETE FROM trucks WHERE id=$1", t.ID)
+
+	return affectedRow(res, err, "Truck")
+}
+
+// Either a *sql.Row or *sql.Rows, so one scan function serves both
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	return err
+// Stores a zero ID as NULL, for optional foreign keys
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
 }
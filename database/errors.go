@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// What sort of failure an Error is, which decides the status it's answered with
+type ErrorKind int
+
+const (
+	NotFound ErrorKind = iota + 1
+	Conflict
+	Validation
+	Unauthorized
+	Forbidden
+)
+
+// An error caused by the request rather than the server: what sort of failure
+// it is, a stable code clients can match on and a message that's safe to show
+// them. Err is what the store ran into, for logs
+type Error struct {
+	Kind 		ErrorKind
+	Code 		string
+	Message 	string
+	Err 		error
+}
+
+func NewError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Matches any Error of the same kind, so errors.Is(err, ErrNotFound) holds for
+// every missing row whatever it was
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// One of each kind, to compare errors against with errors.Is
+var (
+	ErrNotFound 	= NewError(NotFound, "not_found", "Not found")
+	ErrConflict 	= NewError(Conflict, "conflict", "Conflicts with an existing record")
+	ErrValidation 	= NewError(Validation, "invalid_request", "Invalid request")
+	ErrUnauthorized = NewError(Unauthorized, "unauthorized", "Unauthorized")
+	ErrForbidden 	= NewError(Forbidden, "forbidden", "Forbidden")
+)
+
+// The error for a missing row of what, such as "Menu item", which is coded
+// menu_item_not_found. It wraps sql.ErrNoRows
+func notFound(what string) *Error {
+	code := strings.ReplaceAll(strings.ToLower(what), " ", "_") + "_not_found"
+	return &Error{Kind: NotFound, Code: code, Message: what + " not found", Err: sql.ErrNoRows}
+}
+
+// What a statement that should have changed a row of what returns: its error
+// translated, or a NotFound error for what if no row matched
+func affectedRow(res sql.Result, err error, what string) error {
+	if err != nil {
+		return translate(err, "")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound(what)
+	}
+	return nil
+}
+
+// Unique constraints whose violations clients are told about by name
+var uniqueViolations = map[string]*Error{
+	"users_username_key": 	NewError(Conflict, "username_taken", "Username is already taken"),
+	"users_email_key": 		NewError(Conflict, "email_taken", "Email is already registered"),
+}
+
+// The Conflict error for a violation of the named unique constraint
+func uniqueViolation(constraint string, err error) *Error {
+	e := *ErrConflict
+	if known, ok := uniqueViolations[constraint]; ok {
+		e = *known
+	}
+	e.Err = err
+	return &e
+}
+
+// What a write referring to a row that doesn't exist fails with
+func invalidReference(err error) *Error {
+	return &Error{Kind: Validation, Code: "invalid_reference", Message: "Refers to a record that doesn't exist", Err: err}
+}
+
+// Turns what Postgres returned into an *Error where the request is to blame:
+// a missing row becomes a NotFound error for what, and a violated constraint
+// or malformed value a Conflict or Validation error. Anything else, nil
+// included, is returned as is
+func translate(err error, what string) error {
+	if err == sql.ErrNoRows && what != "" {
+		return notFound(what)
+	}
+
+	var translated *Error
+	var pqErr *pq.Error
+	if errors.As(err, &translated) || !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case "23505": // unique_violation
+		return uniqueViolation(pqErr.Constraint, err)
+	case "23503": // foreign_key_violation
+		return invalidReference(err)
+	case "23502", "23514", "22001", "22003", "22007", "22P02":
+		// not_null_violation, check_violation, string_data_right_truncation,
+		// numeric_value_out_of_range, invalid_datetime_format and
+		// invalid_text_representation
+		return &Error{Kind: Validation, Code: "invalid_value", Message: "Invalid value", Err: err}
+	case "40001", "40P01":
+		// What's left of a serialization failure or deadlock once the unit
+		// of work has given up retrying
+		return &Error{Kind: Conflict, Code: "concurrent_update", Message: "Conflicts with a concurrent update, try again", Err: err}
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+)
+
+// Adds the truck to the user's favorites. Returns false if it already was one
+func (pg *Postgres) AddFavorite(ctx context.Context, userID, truckID int) (bool, error) {
+	res, err := pg.db.ExecContext(ctx, "INSERT INTO favorites (user_id, truck_id) VALUES($1, $2) ON CONFLICT DO NOTHING", userID, truckID)
+	if err != nil {
+		return false, translate(err, "")
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Removes the truck from the user's favorites. Returns false if it wasn't one
+func (pg *Postgres) RemoveFavorite(ctx context.Context, userID, truckID int) (bool, error) {
+	res, err := pg.db.ExecContext(ctx, "DELETE FROM favorites WHERE user_id=$1 AND truck_id=$2", userID, truckID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Returns a page of the trucks the user follows, most recently added first,
+// with their hours and schedules
+func (pg *Postgres) GetFavoriteTrucks(ctx context.Context, userID int, p PageRequest) ([]Truck, Page, error) {
+	q := listQuery{
+		columns: truckColumns,
+		from: `(
+		SELECT trucks.*, favorites.created_at AS favorited_at
+		FROM trucks JOIN favorites ON favorites.truck_id = trucks.id
+		WHERE favorites.user_id = $1
+		) AS trucks`,
+		args: []interface{}{userID},
+		order: keyset{"recent", []string{"favorited_at", "id"}, true},
+	}
+
+	scanned := []Truck{}
+	page, err := q.run(ctx, pg.db, p, func(row rowScanner, keys ...interface{}) error {
+		var t Truck
+		if err := scanTruck(row, &t, keys...); err != nil {
+			return err
+		}
+		scanned = append(scanned, t)
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]Truck, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+	if err := loadTruckDetails(ctx, pg.db, truckPointers(trucks)); err != nil {
+		return nil, page, err
+	}
+
+	return trucks, page, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// Replaces the truck's weekly hours and exceptions with the ones it holds
+func (t *Truck) saveHours(ctx context.Context, db DBTX) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM truck_hours WHERE truck_id=$1", t.ID); err != nil {
+		return err
+	}
+	for _, h := range t.Hours {
+		_, err := db.ExecContext(ctx, "INSERT INTO truck_hours (truck_id, weekday, opens_at, closes_at) VALUES($1, $2, $3, $4)",
+			t.ID, int(h.Day), h.Opens.String(), h.Closes.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM truck_hours_exceptions WHERE truck_id=$1", t.ID); err != nil {
+		return err
+	}
+	for _, e := range t.HoursExceptions {
+		var opens, closes sql.NullString
+		if !e.Closed {
+			opens = sql.NullString{String: e.Opens.String(), Valid: true}
+			closes = sql.NullString{String: e.Closes.String(), Valid: true}
+		}
+		_, err := db.ExecContext(ctx, "INSERT INTO truck_hours_exceptions (truck_id, date, closed, opens_at, closes_at, note) VALUES($1, $2, $3, $4, $5, $6)",
+			t.ID, e.Date.Format(domain.DateLayout), e.Closed, opens, closes, e.Note)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fills in the weekly hours and exceptions of every truck, with one query for
+// each
+func loadTruckHours(ctx context.Context, db DBTX, trucks []*Truck) error {
+	if len(trucks) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(trucks))
+	byID := make(map[int]*Truck, len(trucks))
+	for i, t := range trucks {
+		ids[i] = int64(t.ID)
+		t.Hours = []domain.Hours{}
+		t.HoursExceptions = []domain.HoursException{}
+		byID[t.ID] = t
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT truck_id, weekday, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI') FROM truck_hours WHERE truck_id = ANY($1) ORDER BY weekday, opens_at",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var truckID, weekday int
+		var opens, closes string
+		if err := rows.Scan(&truckID, &weekday, &opens, &closes); err != nil {
+			return err
+		}
+		h := domain.Hours{Day: time.Weekday(weekday)}
+		if h.Opens, err = domain.ParseClock(opens); err != nil {
+			return err
+		}
+		if h.Closes, err = domain.ParseClock(closes); err != nil {
+			return err
+		}
+		t := byID[truckID]
+		t.Hours = append(t.Hours, h)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT truck_id, date, closed, coalesce(to_char(opens_at, 'HH24:MI'), ''), coalesce(to_char(closes_at, 'HH24:MI'), ''), note FROM truck_hours_exceptions WHERE truck_id = ANY($1) ORDER BY date",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var truckID int
+		var opens, closes string
+		var e domain.HoursException
+		if err := rows.Scan(&truckID, &e.Date, &e.Closed, &opens, &closes, &e.Note); err != nil {
+			return err
+		}
+		if !e.Closed {
+			if e.Opens, err = domain.ParseClock(opens); err != nil {
+				return err
+			}
+			if e.Closes, err = domain.ParseClock(closes); err != nil {
+				return err
+			}
+		}
+		t := byID[truckID]
+		t.HoursExceptions = append(t.HoursExceptions, e)
+	}
+
+	return rows.Err()
+}
+
+func (t *Truck) timezone() string {
+	if t.Timezone == "" {
+		return "UTC"
+	}
+	return t.Timezone
+}
+
+func marshalLinks(links map[string]string) ([]byte, error) {
+	if links == nil {
+		links = map[string]string{}
+	}
+	return json.Marshal(links)
+}
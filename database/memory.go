@@ -0,0 +1,634 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The store kept in memory, for running the handlers without a database. It
+// behaves like Postgres down to the cascades of the schema's foreign keys,
+// but searches trucks with a simpler tokenizer than full-text search
+type Memory struct {
+	mu 				sync.Mutex
+	// The last ID handed out, by table
+	ids 			map[string]int
+	users 			map[int]User
+	trucks 			map[int]Truck
+	locations 		[]memLocation
+	slots 			map[int]ScheduleSlot
+	events 			map[int]ScheduleEvent
+	favorites 		[]memFavorite
+	menus 			map[int]Menu
+	categories 		map[int]MenuCategory
+	items 			map[int]MenuItem
+	groups 			map[int]MenuOptionGroup
+	orders 			map[int]Order
+	history 		[]OrderStatusChange
+	reviews 		map[int]Review
+	denylist 		map[string]bool
+	cutoffs 		map[int]time.Time
+	refreshTokens 	map[int]RefreshToken
+}
+
+type memLocation struct {
+	ID 		int
+	TruckID int
+	Location
+}
+
+type memFavorite struct {
+	UserID 		int
+	TruckID 	int
+	CreatedAt 	time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		ids: map[string]int{},
+		users: map[int]User{},
+		trucks: map[int]Truck{},
+		slots: map[int]ScheduleSlot{},
+		events: map[int]ScheduleEvent{},
+		menus: map[int]Menu{},
+		categories: map[int]MenuCategory{},
+		items: map[int]MenuItem{},
+		groups: map[int]MenuOptionGroup{},
+		orders: map[int]Order{},
+		reviews: map[int]Review{},
+		denylist: map[string]bool{},
+		cutoffs: map[int]time.Time{},
+		refreshTokens: map[int]RefreshToken{},
+	}
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Runs fn against a copy of the store and keeps the copy's state only if fn
+// returns nil, so an error or panic leaves the store as it was. Other calls
+// wait until fn is done, which also means the copy never conflicts with them
+func (m *Memory) WithTx(ctx context.Context, fn func(s Store) error) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	tx := m.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.adopt(tx)
+	return nil
+}
+
+// Copies the state of the store deeply enough that changes to the copy never
+// reach it, including the lines of orders that cascades edit in place
+func (m *Memory) clone() *Memory {
+	c := NewMemory()
+	for table, id := range m.ids {
+		c.ids[table] = id
+	}
+	for id, u := range m.users {
+		c.users[id] = u
+	}
+	for id, t := range m.trucks {
+		var location *Location
+		if t.Location != nil {
+			loc := *t.Location
+			location = &loc
+		}
+		c.trucks[id] = storedTruck(t, location)
+	}
+	c.locations = append([]memLocation{}, m.locations...)
+	for id, s := range m.slots {
+		c.slots[id] = s
+	}
+	for id, e := range m.events {
+		c.events[id] = e
+	}
+	c.favorites = append([]memFavorite{}, m.favorites...)
+	for id, menu := range m.menus {
+		c.menus[id] = menu
+	}
+	for id, category := range m.categories {
+		c.categories[id] = category
+	}
+	for id, item := range m.items {
+		c.items[id] = copyMenuItem(item)
+	}
+	for id, g := range m.groups {
+		c.groups[id] = copyOptionGroup(g)
+	}
+	for id, o := range m.orders {
+		c.orders[id] = copyOrder(o)
+	}
+	c.history = append([]OrderStatusChange{}, m.history...)
+	for id, r := range m.reviews {
+		c.reviews[id] = r
+	}
+	for key, revoked := range m.denylist {
+		c.denylist[key] = revoked
+	}
+	for userID, cutoff := range m.cutoffs {
+		c.cutoffs[userID] = cutoff
+	}
+	for id, rt := range m.refreshTokens {
+		c.refreshTokens[id] = rt
+	}
+	return c
+}
+
+// Takes over the state of a copy that fn finished with
+func (m *Memory) adopt(tx *Memory) {
+	m.ids, m.users, m.trucks, m.locations = tx.ids, tx.users, tx.trucks, tx.locations
+	m.slots, m.events, m.favorites = tx.slots, tx.events, tx.favorites
+	m.menus, m.categories, m.items, m.groups = tx.menus, tx.categories, tx.items, tx.groups
+	m.orders, m.history, m.reviews = tx.orders, tx.history, tx.reviews
+	m.denylist, m.cutoffs, m.refreshTokens = tx.denylist, tx.cutoffs, tx.refreshTokens
+}
+
+// Deletes every truck along with everything that belongs to them, and
+// restarts the IDs of all of it at 1
+func (m *Memory) ClearTrucks() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.trucks {
+		m.deleteTruck(id)
+	}
+	for _, table := range []string{"trucks", "truck_locations", "truck_schedule_slots", "truck_schedule_events",
+		"menus", "menu_categories", "menu_items", "menu_option_groups", "menu_options",
+		"orders", "order_items", "order_item_options", "order_status_history", "reviews"} {
+		delete(m.ids, table)
+	}
+}
+
+// Deletes every user and revoked or refresh token, and restarts user IDs at 1.
+// Trucks stay, without their owners
+func (m *Memory) ClearUsers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.users {
+		m.deleteUser(id)
+	}
+	m.denylist = map[string]bool{}
+	m.cutoffs = map[int]time.Time{}
+	m.refreshTokens = map[int]RefreshToken{}
+	delete(m.ids, "users")
+}
+
+// Takes the lock unless the context is already done, so a cancelled or timed
+// out request fails here like it would in the middle of a query
+func (m *Memory) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	return nil
+}
+
+func (m *Memory) nextID(table string) int {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+// What a foreign key violation translates to from Postgres
+func missingRow(table string, id int) error {
+	return invalidReference(fmt.Errorf("no row in %s with id %d", table, id))
+}
+
+func (m *Memory) GetUser(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return notFound("User")
+	}
+	*u = stored
+	return nil
+}
+
+func (m *Memory) GetUserByUsername(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	for _, stored := range m.users {
+		if stored.Username == u.Username {
+			*u = stored
+			return nil
+		}
+	}
+	return notFound("User")
+}
+
+func (m *Memory) GetUsers(ctx context.Context, role string, p PageRequest) ([]User, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []User{}
+	for _, u := range m.users {
+		if role == "" || u.Role == role {
+			rows = append(rows, u)
+		}
+	}
+
+	scanned := []User{}
+	page, err := pageRows(keyset{"id", []string{"id"}, false}, len(rows), func(i int) []interface{} {
+		return []interface{}{int64(rows[i].ID)}
+	}, p, func(i int) {
+		scanned = append(scanned, rows[i])
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	users := make([]User, 0, len(page.rows))
+	for _, i := range page.rows {
+		users = append(users, scanned[i])
+	}
+	return users, page, nil
+}
+
+func (m *Memory) UsernameExists(ctx context.Context, username string, excludeID int) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Username == username && u.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) EmailExists(ctx context.Context, email string, excludeID int) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) && u.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if err := m.checkUserUnique(*u); err != nil {
+		return err
+	}
+	if u.Role == "" {
+		u.Role = RoleCustomer
+	}
+	u.ID = m.nextID("users")
+	m.users[u.ID] = *u
+	return nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return notFound("User")
+	}
+	if err := m.checkUserUnique(*u); err != nil {
+		return err
+	}
+	hash := stored.Hash
+	stored = *u
+	stored.Hash = hash
+	m.users[u.ID] = stored
+	return nil
+}
+
+// Fails like the unique keys on users would if another user already has u's
+// username or, in any case, email
+func (m *Memory) checkUserUnique(u User) error {
+	for _, other := range m.users {
+		if other.ID == u.ID {
+			continue
+		}
+		if other.Username == u.Username {
+			return uniqueViolation("users_username_key", nil)
+		}
+		if strings.EqualFold(other.Email, u.Email) {
+			return uniqueViolation("users_email_key", nil)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) UpdatePassword(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return notFound("User")
+	}
+	stored.Hash = u.Hash
+	m.users[u.ID] = stored
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.ID]; !ok {
+		return notFound("User")
+	}
+	m.deleteUser(u.ID)
+	return nil
+}
+
+func (m *Memory) SetHasTruck(ctx context.Context, u *User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return notFound("User")
+	}
+	stored.HasTruck = true
+	if stored.Role == RoleCustomer {
+		stored.Role = RoleTruckOwner
+	}
+	m.users[u.ID] = stored
+	return nil
+}
+
+// Deletes the user, their orders, reviews, favorites, token cutoff and refresh
+// tokens, and disowns their trucks
+func (m *Memory) deleteUser(id int) {
+	delete(m.users, id)
+	delete(m.cutoffs, id)
+	for rtID, rt := range m.refreshTokens {
+		if rt.UserID == id {
+			delete(m.refreshTokens, rtID)
+		}
+	}
+	for truckID, t := range m.trucks {
+		if t.OwnerID == id {
+			t.OwnerID = 0
+			m.trucks[truckID] = t
+		}
+	}
+	for orderID, o := range m.orders {
+		if o.UserID == id {
+			m.deleteOrder(orderID)
+		}
+	}
+	for i := range m.history {
+		if m.history[i].ChangedBy == id {
+			m.history[i].ChangedBy = 0
+		}
+	}
+	for reviewID, r := range m.reviews {
+		if r.UserID == id {
+			delete(m.reviews, reviewID)
+			m.updateTruckRating(r.TruckID)
+		}
+	}
+	favorites := m.favorites[:0]
+	for _, f := range m.favorites {
+		if f.UserID != id {
+			favorites = append(favorites, f)
+		}
+	}
+	m.favorites = favorites
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, jti string, userID int) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	m.denylist[jti] = true
+	return nil
+}
+
+func (m *Memory) RevokeAllTokens(ctx context.Context, userID int, cutoff time.Time) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	m.cutoffs[userID] = cutoff
+	return nil
+}
+
+func (m *Memory) IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	cutoff, ok := m.cutoffs[userID]
+	return m.denylist[jti] || (ok && cutoff.After(issuedAt)), nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	for _, stored := range m.refreshTokens {
+		if stored.TokenHash == rt.TokenHash {
+			return fmt.Errorf("refresh token hash already exists")
+		}
+	}
+	rt.ID = m.nextID("refresh_tokens")
+	m.refreshTokens[rt.ID] = RefreshToken{
+		ID: rt.ID,
+		TokenHash: rt.TokenHash,
+		Family: rt.Family,
+		UserID: rt.UserID,
+		ExpiresAt: rt.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) GetRefreshTokenByHash(ctx context.Context, rt *RefreshToken) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	for _, stored := range m.refreshTokens {
+		if stored.TokenHash == rt.TokenHash {
+			*rt = stored
+			return nil
+		}
+	}
+	return notFound("Refresh token")
+}
+
+func (m *Memory) MarkRefreshTokenUsed(ctx context.Context, rt *RefreshToken) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.refreshTokens[rt.ID]
+	if !ok || stored.UsedAt.Valid || stored.Revoked {
+		return false, nil
+	}
+	stored.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	m.refreshTokens[rt.ID] = stored
+	return true, nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	for id, stored := range m.refreshTokens {
+		if stored.Family == family {
+			stored.Revoked = true
+			m.refreshTokens[id] = stored
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeAllRefreshTokens(ctx context.Context, userID int) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	for id, stored := range m.refreshTokens {
+		if stored.UserID == userID {
+			stored.Revoked = true
+			m.refreshTokens[id] = stored
+		}
+	}
+	return nil
+}
+
+// Pages through n rows held in memory the way listQuery pages through a
+// table. keys returns the values of the order's keys for row i, and scan is
+// called for every row read, in order, which page.rows then indexes into
+func pageRows(order keyset, n int, keys func(i int) []interface{}, p PageRequest, scan func(i int), loadBatch func(from, to int) error, keep func(i int) bool) (Page, error) {
+	values := make([][]interface{}, n)
+	sorted := make([]int, n)
+	for i := range values {
+		values[i] = keys(i)
+		sorted[i] = i
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return compareKeys(values[sorted[a]], values[sorted[b]]) < 0
+	})
+
+	count := func() (int, error) {
+		return n, nil
+	}
+	fetch := func(after []interface{}, forward bool, limit int) ([][]interface{}, error) {
+		desc := order.desc != !forward
+		batch := [][]interface{}{}
+		for j := 0; j < n && len(batch) < limit; j++ {
+			i := sorted[j]
+			if desc {
+				i = sorted[n-1-j]
+			}
+			if after != nil {
+				cmp := compareKeys(values[i], after)
+				if (!desc && cmp <= 0) || (desc && cmp >= 0) {
+					continue
+				}
+			}
+			scan(i)
+			batch = append(batch, values[i])
+		}
+		return batch, nil
+	}
+	return paginate(order, p, count, fetch, loadBatch, keep)
+}
+
+// Compares two rows' keys in order. Numbers from a decoded cursor may be
+// int64 or float64 whatever they were encoded from, so they compare by value
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if i >= len(b) {
+			return 1
+		}
+		if cmp := compareKey(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareKey(a, b interface{}) int {
+	if as, ok := a.(string); ok {
+		bs, _ := b.(string)
+		return strings.Compare(as, bs)
+	}
+	ai, aInt := a.(int64)
+	bi, bInt := b.(int64)
+	if aInt && bInt {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+	af, bf := keyFloat(a), keyFloat(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return 0
+}
+
+func keyFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
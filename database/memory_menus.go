@@ -0,0 +1,404 @@
+package database
+
+import (
+	"context"
+	"sort"
+)
+
+func (m *Memory) GetMenu(ctx context.Context, menu *Menu) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.menuOf(menu.TruckID)
+	if !ok {
+		return notFound("Menu")
+	}
+	*menu = stored
+	return nil
+}
+
+func (m *Memory) GetOrCreateMenu(ctx context.Context, menu *Menu) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.menuOf(menu.TruckID)
+	if !ok {
+		if _, ok := m.trucks[menu.TruckID]; !ok {
+			return missingRow("trucks", menu.TruckID)
+		}
+		stored = Menu{ID: m.nextID("menus"), TruckID: menu.TruckID, Name: "Menu"}
+		m.menus[stored.ID] = stored
+	}
+	*menu = stored
+	return nil
+}
+
+func (m *Memory) UpdateMenu(ctx context.Context, menu *Menu) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.menus[menu.ID]; ok {
+		stored.Name = menu.Name
+		m.menus[menu.ID] = stored
+	}
+	return nil
+}
+
+func (m *Memory) menuOf(truckID int) (Menu, bool) {
+	for _, menu := range m.menus {
+		if menu.TruckID == truckID {
+			return menu, true
+		}
+	}
+	return Menu{}, false
+}
+
+func (m *Memory) GetMenuCategory(ctx context.Context, c *MenuCategory) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.categories[c.ID]
+	if !ok {
+		return notFound("Category")
+	}
+	*c = m.loadCategory(stored)
+	return nil
+}
+
+func (m *Memory) CreateMenuCategory(ctx context.Context, c *MenuCategory) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.menus[c.MenuID]; !ok {
+		return missingRow("menus", c.MenuID)
+	}
+	c.ID = m.nextID("menu_categories")
+	m.categories[c.ID] = MenuCategory{ID: c.ID, MenuID: c.MenuID, Name: c.Name, Position: c.Position}
+	return nil
+}
+
+func (m *Memory) UpdateMenuCategory(ctx context.Context, c *MenuCategory) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.categories[c.ID]; ok {
+		stored.Name = c.Name
+		stored.Position = c.Position
+		m.categories[c.ID] = stored
+	}
+	return nil
+}
+
+func (m *Memory) DeleteMenuCategory(ctx context.Context, c *MenuCategory) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.categories, c.ID)
+	for id, item := range m.items {
+		if item.CategoryID == c.ID {
+			item.CategoryID = 0
+			m.items[id] = item
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetMenuCategories(ctx context.Context, truckID int) ([]MenuCategory, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	categories := []MenuCategory{}
+	for _, stored := range m.categories {
+		if c := m.loadCategory(stored); c.TruckID == truckID {
+			categories = append(categories, c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		return a.Position < b.Position || (a.Position == b.Position && a.ID < b.ID)
+	})
+	return categories, nil
+}
+
+// Fills in the truck the category's menu belongs to
+func (m *Memory) loadCategory(c MenuCategory) MenuCategory {
+	c.TruckID = m.menus[c.MenuID].TruckID
+	return c
+}
+
+func (m *Memory) GetMenuItem(ctx context.Context, item *MenuItem) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.items[item.ID]
+	if !ok {
+		return notFound("Menu item")
+	}
+	*item = copyMenuItem(stored)
+	return nil
+}
+
+func (m *Memory) CreateMenuItem(ctx context.Context, item *MenuItem) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.trucks[item.TruckID]; !ok {
+		return missingRow("trucks", item.TruckID)
+	}
+	if _, ok := m.categories[item.CategoryID]; item.CategoryID != 0 && !ok {
+		return missingRow("menu_categories", item.CategoryID)
+	}
+	item.ID = m.nextID("menu_items")
+	m.items[item.ID] = copyMenuItem(*item)
+	return nil
+}
+
+func (m *Memory) UpdateMenuItem(ctx context.Context, item *MenuItem) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.items[item.ID]
+	if !ok {
+		return nil
+	}
+	if _, ok := m.categories[item.CategoryID]; item.CategoryID != 0 && !ok {
+		return missingRow("menu_categories", item.CategoryID)
+	}
+	updated := copyMenuItem(*item)
+	updated.TruckID = stored.TruckID
+	m.items[item.ID] = updated
+	return nil
+}
+
+func (m *Memory) SetMenuItemAvailable(ctx context.Context, item *MenuItem, available bool) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.items[item.ID]; ok {
+		stored.Available = available
+		m.items[item.ID] = stored
+	}
+	item.Available = available
+	return nil
+}
+
+func (m *Memory) DeleteMenuItem(ctx context.Context, item *MenuItem) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	m.deleteMenuItem(item.ID)
+	return nil
+}
+
+func (m *Memory) GetMenuItems(ctx context.Context, truckID int) ([]MenuItem, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	items := []MenuItem{}
+	for _, stored := range m.items {
+		if stored.TruckID == truckID {
+			items = append(items, copyMenuItem(stored))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+	return items, nil
+}
+
+// Deletes the item and its option groups. Orders keep their lines for it
+func (m *Memory) deleteMenuItem(id int) {
+	delete(m.items, id)
+	for groupID, g := range m.groups {
+		if g.MenuItemID == id {
+			m.deleteOptionGroup(groupID)
+		}
+	}
+	for orderID, o := range m.orders {
+		for i := range o.Items {
+			if o.Items[i].MenuItemID == id {
+				o.Items[i].MenuItemID = 0
+			}
+		}
+		m.orders[orderID] = o
+	}
+}
+
+func copyMenuItem(item MenuItem) MenuItem {
+	item.DietaryTags = append([]string{}, item.DietaryTags...)
+	return item
+}
+
+func (m *Memory) GetOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.groups[g.ID]
+	if !ok {
+		return notFound("Option group")
+	}
+	*g = copyOptionGroup(stored)
+	return nil
+}
+
+func (m *Memory) CreateOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[g.MenuItemID]; !ok {
+		return missingRow("menu_items", g.MenuItemID)
+	}
+	g.ID = m.nextID("menu_option_groups")
+	for i := range g.Options {
+		g.Options[i].ID = m.nextID("menu_options")
+		g.Options[i].GroupID = g.ID
+	}
+	m.groups[g.ID] = copyOptionGroup(*g)
+	return nil
+}
+
+// Syncs the options like the Postgres store: options with an ID in this
+// group are updated, new ones are added and the rest are deleted
+func (m *Memory) UpdateOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.groups[g.ID]
+	if !ok {
+		return nil
+	}
+
+	existing := map[int]bool{}
+	for _, o := range stored.Options {
+		existing[o.ID] = true
+	}
+	options := []MenuOption{}
+	for i := range g.Options {
+		o := &g.Options[i]
+		o.GroupID = g.ID
+		if o.ID == 0 {
+			o.ID = m.nextID("menu_options")
+		} else if !existing[o.ID] {
+			continue
+		}
+		options = append(options, *o)
+	}
+	m.clearOrderedOptions(stored, options)
+
+	stored.Name = g.Name
+	stored.MinSelections = g.MinSelections
+	stored.MaxSelections = g.MaxSelections
+	stored.Position = g.Position
+	stored.Options = options
+	m.groups[g.ID] = copyOptionGroup(stored)
+	return nil
+}
+
+func (m *Memory) DeleteOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	m.deleteOptionGroup(g.ID)
+	return nil
+}
+
+func (m *Memory) GetOptionGroups(ctx context.Context, menuItemIDs []int) (map[int][]MenuOptionGroup, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	byItem := map[int][]MenuOptionGroup{}
+	groups := []MenuOptionGroup{}
+	for _, stored := range m.groups {
+		for _, id := range menuItemIDs {
+			if stored.MenuItemID == id {
+				groups = append(groups, copyOptionGroup(stored))
+				break
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		return a.Position < b.Position || (a.Position == b.Position && a.ID < b.ID)
+	})
+	for _, g := range groups {
+		byItem[g.MenuItemID] = append(byItem[g.MenuItemID], g)
+	}
+	return byItem, nil
+}
+
+func (m *Memory) deleteOptionGroup(id int) {
+	if g, ok := m.groups[id]; ok {
+		m.clearOrderedOptions(g, nil)
+	}
+	delete(m.groups, id)
+}
+
+// Unlinks the options of g that aren't in keep from the order lines they
+// were chosen on, as deleting them does in Postgres
+func (m *Memory) clearOrderedOptions(g MenuOptionGroup, keep []MenuOption) {
+	deleted := map[int]bool{}
+	for _, o := range g.Options {
+		deleted[o.ID] = true
+	}
+	for _, o := range keep {
+		delete(deleted, o.ID)
+	}
+	for orderID, o := range m.orders {
+		for i := range o.Items {
+			for j := range o.Items[i].Options {
+				if opt := &o.Items[i].Options[j]; deleted[opt.OptionID] {
+					opt.OptionID = 0
+				}
+			}
+		}
+		m.orders[orderID] = o
+	}
+}
+
+// Copies the group with its options in display order
+func copyOptionGroup(g MenuOptionGroup) MenuOptionGroup {
+	g.Options = append([]MenuOption{}, g.Options...)
+	sort.SliceStable(g.Options, func(i, j int) bool {
+		a, b := g.Options[i], g.Options[j]
+		return a.Position < b.Position || (a.Position == b.Position && a.ID < b.ID)
+	})
+	return g
+}
@@ -0,0 +1,349 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+func (m *Memory) GetOrder(ctx context.Context, o *Order) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.orders[o.ID]
+	if !ok {
+		return notFound("Order")
+	}
+	*o = copyOrder(stored)
+	return nil
+}
+
+func (m *Memory) CreateOrder(ctx context.Context, o *Order) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[o.UserID]; !ok {
+		return missingRow("users", o.UserID)
+	}
+	if _, ok := m.trucks[o.TruckID]; !ok {
+		return missingRow("trucks", o.TruckID)
+	}
+
+	o.ID = m.nextID("orders")
+	o.Status = domain.StatusPlaced
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.ID = m.nextID("order_items")
+		item.OrderID = o.ID
+		for j := range item.Options {
+			item.Options[j].ID = m.nextID("order_item_options")
+			item.Options[j].OrderItemID = item.ID
+		}
+	}
+	m.orders[o.ID] = copyOrder(*o)
+
+	m.history = append(m.history, OrderStatusChange{
+		ID: m.nextID("order_status_history"),
+		OrderID: o.ID,
+		ToStatus: o.Status,
+		ChangedBy: o.UserID,
+		ChangedAt: o.CreatedAt,
+	})
+	return nil
+}
+
+func (m *Memory) TransitionOrderStatus(ctx context.Context, o *Order, to string, changedBy int, reason string) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.orders[o.ID]
+	if !ok || stored.Status != o.Status {
+		return false, nil
+	}
+	from := o.Status
+	stored.Status = to
+	stored.UpdatedAt = time.Now()
+	m.orders[o.ID] = stored
+	o.Status = to
+	o.UpdatedAt = stored.UpdatedAt
+
+	m.history = append(m.history, OrderStatusChange{
+		ID: m.nextID("order_status_history"),
+		OrderID: o.ID,
+		FromStatus: from,
+		ToStatus: to,
+		ChangedBy: changedBy,
+		Reason: reason,
+		ChangedAt: o.UpdatedAt,
+	})
+	return true, nil
+}
+
+func (m *Memory) GetOrderHistory(ctx context.Context, orderID int) ([]OrderStatusChange, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	history := []OrderStatusChange{}
+	for _, c := range m.history {
+		if c.OrderID == orderID {
+			history = append(history, c)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].ChangedAt.Before(history[j].ChangedAt)
+	})
+	return history, nil
+}
+
+func (m *Memory) DeleteOrder(ctx context.Context, o *Order) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	m.deleteOrder(o.ID)
+	return nil
+}
+
+func (m *Memory) GetOrdersForUser(ctx context.Context, userID int, p PageRequest) ([]Order, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	return m.queryOrders(func(o Order) bool { return o.UserID == userID }, p)
+}
+
+func (m *Memory) GetOrdersForTruck(ctx context.Context, truckID int, p PageRequest) ([]Order, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	return m.queryOrders(func(o Order) bool { return o.TruckID == truckID }, p)
+}
+
+func (m *Memory) queryOrders(match func(o Order) bool, p PageRequest) ([]Order, Page, error) {
+	rows := []Order{}
+	for _, o := range m.orders {
+		if match(o) {
+			rows = append(rows, o)
+		}
+	}
+
+	scanned := []Order{}
+	page, err := pageRows(keyset{"newest", []string{"id"}, true}, len(rows), func(i int) []interface{} {
+		return []interface{}{int64(rows[i].ID)}
+	}, p, func(i int) {
+		scanned = append(scanned, copyOrder(rows[i]))
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	orders := make([]Order, 0, len(page.rows))
+	for _, i := range page.rows {
+		orders = append(orders, scanned[i])
+	}
+	return orders, page, nil
+}
+
+// Deletes the order with its history. Reviews of it stay, unlinked
+func (m *Memory) deleteOrder(id int) {
+	delete(m.orders, id)
+
+	history := m.history[:0]
+	for _, c := range m.history {
+		if c.OrderID != id {
+			history = append(history, c)
+		}
+	}
+	m.history = history
+
+	for reviewID, r := range m.reviews {
+		if r.OrderID == id {
+			r.OrderID = 0
+			m.reviews[reviewID] = r
+		}
+	}
+}
+
+// Copies the order down to the options of its lines
+func copyOrder(o Order) Order {
+	items := make([]OrderItem, len(o.Items))
+	for i, item := range o.Items {
+		item.Options = append([]OrderItemOption{}, item.Options...)
+		items[i] = item
+	}
+	o.Items = items
+	return o
+}
+
+func (m *Memory) GetReview(ctx context.Context, r *Review) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.reviews[r.ID]
+	if !ok {
+		return notFound("Review")
+	}
+	*r = m.loadReview(stored)
+	return nil
+}
+
+func (m *Memory) SaveReview(ctx context.Context, r *Review) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.trucks[r.TruckID]; !ok {
+		return false, missingRow("trucks", r.TruckID)
+	}
+	if _, ok := m.users[r.UserID]; !ok {
+		return false, missingRow("users", r.UserID)
+	}
+	if _, ok := m.orders[r.OrderID]; r.OrderID != 0 && !ok {
+		return false, missingRow("orders", r.OrderID)
+	}
+
+	now := time.Now()
+	for id, stored := range m.reviews {
+		if stored.TruckID == r.TruckID && stored.UserID == r.UserID {
+			stored.OrderID = r.OrderID
+			stored.Rating = r.Rating
+			stored.Body = r.Body
+			stored.UpdatedAt = now
+			m.reviews[id] = stored
+			m.updateTruckRating(r.TruckID)
+			r.ID, r.CreatedAt, r.UpdatedAt = stored.ID, stored.CreatedAt, stored.UpdatedAt
+			return false, nil
+		}
+	}
+
+	r.ID = m.nextID("reviews")
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	m.reviews[r.ID] = Review{
+		ID: r.ID,
+		TruckID: r.TruckID,
+		UserID: r.UserID,
+		OrderID: r.OrderID,
+		Rating: r.Rating,
+		Body: r.Body,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	m.updateTruckRating(r.TruckID)
+	return true, nil
+}
+
+// Recomputes the stored truck's average rating and review count from its
+// reviews, as the trigger on reviews does in Postgres
+func (m *Memory) updateTruckRating(truckID int) {
+	t, ok := m.trucks[truckID]
+	if !ok {
+		return
+	}
+
+	sum := 0
+	t.Rating, t.RatingCount = 0, 0
+	for _, r := range m.reviews {
+		if r.TruckID == truckID {
+			sum += r.Rating
+			t.RatingCount++
+		}
+	}
+	if t.RatingCount > 0 {
+		t.Rating = float64(sum) / float64(t.RatingCount)
+	}
+	m.trucks[truckID] = t
+}
+
+func (m *Memory) SetReviewReply(ctx context.Context, r *Review, reply string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.reviews[r.ID]
+	if !ok {
+		return notFound("Review")
+	}
+	stored.Reply = reply
+	stored.RepliedAt = nil
+	if reply != "" {
+		now := time.Now()
+		stored.RepliedAt = &now
+	}
+	m.reviews[r.ID] = stored
+	r.RepliedAt = stored.RepliedAt
+	return nil
+}
+
+func (m *Memory) DeleteReview(ctx context.Context, r *Review) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.reviews[r.ID]; ok {
+		delete(m.reviews, r.ID)
+		m.updateTruckRating(stored.TruckID)
+	}
+	return nil
+}
+
+func (m *Memory) GetReviews(ctx context.Context, truckID int, p PageRequest) ([]Review, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []Review{}
+	for _, r := range m.reviews {
+		if r.TruckID == truckID {
+			rows = append(rows, m.loadReview(r))
+		}
+	}
+
+	scanned := []Review{}
+	page, err := pageRows(keyset{"newest", []string{"r.id"}, true}, len(rows), func(i int) []interface{} {
+		return []interface{}{int64(rows[i].ID)}
+	}, p, func(i int) {
+		scanned = append(scanned, rows[i])
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	reviews := make([]Review, 0, len(page.rows))
+	for _, i := range page.rows {
+		reviews = append(reviews, scanned[i])
+	}
+	return reviews, page, nil
+}
+
+// Fills in the author's username
+func (m *Memory) loadReview(r Review) Review {
+	r.Username = m.users[r.UserID].Username
+	if r.RepliedAt != nil {
+		repliedAt := *r.RepliedAt
+		r.RepliedAt = &repliedAt
+	}
+	return r
+}
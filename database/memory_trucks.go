@@ -0,0 +1,596 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+func (m *Memory) GetTruck(ctx context.Context, t *Truck) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.trucks[t.ID]
+	if !ok {
+		return notFound("Truck")
+	}
+	*t = m.loadTruck(stored)
+	return nil
+}
+
+func (m *Memory) GetTrucks(ctx context.Context, f TruckFilter, p PageRequest) ([]Truck, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []Truck{}
+	relevance := map[int]float64{}
+	for _, stored := range m.trucks {
+		t := m.loadTruck(stored)
+		if f.Search != "" {
+			rank, ok := searchRank(t, f.Search)
+			if !ok {
+				continue
+			}
+			relevance[t.ID] = rank
+		}
+		if f.Cuisine != "" && !containsString(t.Cuisines, f.Cuisine) {
+			continue
+		}
+		if f.MinRating > 0 && t.Rating < f.MinRating {
+			continue
+		}
+		rows = append(rows, t)
+	}
+
+	order := f.order()
+	scanned := []Truck{}
+	scan := func(i int) {
+		scanned = append(scanned, rows[i])
+	}
+	keys := func(i int) []interface{} {
+		t := rows[i]
+		switch order.name {
+		case "name", "-name":
+			return []interface{}{strings.ToLower(t.Name), int64(t.ID)}
+		case "rating", "-rating":
+			return []interface{}{t.Rating, int64(t.RatingCount), int64(t.ID)}
+		case "relevance":
+			return []interface{}{relevance[t.ID], int64(t.ID)}
+		}
+		return []interface{}{int64(t.ID)}
+	}
+
+	var keep func(i int) bool
+	if !f.OpenAt.IsZero() {
+		keep = func(i int) bool {
+			return scanned[i].Schedule().IsOpen(f.OpenAt)
+		}
+	}
+	page, err := pageRows(order, len(rows), keys, p, scan, nil, keep)
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]Truck, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+	return trucks, page, nil
+}
+
+func (m *Memory) GetTrucksNear(ctx context.Context, lat, lng, radius float64, since time.Time, p PageRequest) ([]TruckDistance, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []TruckDistance{}
+	for _, stored := range m.trucks {
+		loc := stored.Location
+		if loc == nil || !loc.RecordedAt.After(since) {
+			continue
+		}
+		distance := domain.Haversine(lat, lng, loc.Latitude, loc.Longitude)
+		if distance <= radius {
+			rows = append(rows, TruckDistance{Truck: m.loadTruck(stored), DistanceMeters: distance})
+		}
+	}
+
+	scanned := []TruckDistance{}
+	page, err := pageRows(keyset{"distance", []string{"distance", "id"}, false}, len(rows), func(i int) []interface{} {
+		return []interface{}{rows[i].DistanceMeters, int64(rows[i].ID)}
+	}, p, func(i int) {
+		scanned = append(scanned, rows[i])
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]TruckDistance, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+	return trucks, page, nil
+}
+
+func (m *Memory) CreateTruck(ctx context.Context, t *Truck) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[t.OwnerID]; t.OwnerID != 0 && !ok {
+		return missingRow("users", t.OwnerID)
+	}
+	t.ID = m.nextID("trucks")
+	stored := storedTruck(*t, nil)
+	stored.Rating, stored.RatingCount = 0, 0
+	m.trucks[t.ID] = stored
+	return nil
+}
+
+func (m *Memory) UpdateTruck(ctx context.Context, t *Truck) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.trucks[t.ID]
+	if !ok {
+		return nil
+	}
+	if _, ok := m.users[t.OwnerID]; t.OwnerID != 0 && !ok {
+		return missingRow("users", t.OwnerID)
+	}
+	// The rating is kept up to date by the reviews, not by updates
+	updated := storedTruck(*t, stored.Location)
+	updated.Rating, updated.RatingCount = stored.Rating, stored.RatingCount
+	m.trucks[t.ID] = updated
+	return nil
+}
+
+func (m *Memory) DeleteTruck(ctx context.Context, t *Truck) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.trucks[t.ID]; !ok {
+		return notFound("Truck")
+	}
+	m.deleteTruck(t.ID)
+	return nil
+}
+
+func (m *Memory) RecordLocation(ctx context.Context, t *Truck, loc Location) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.trucks[t.ID]
+	if !ok {
+		return false, missingRow("trucks", t.ID)
+	}
+	m.locations = append(m.locations, memLocation{ID: m.nextID("truck_locations"), TruckID: t.ID, Location: loc})
+
+	if stored.Location != nil && stored.Location.RecordedAt.After(loc.RecordedAt) {
+		return false, nil
+	}
+	current := loc
+	stored.Location = &current
+	m.trucks[t.ID] = stored
+	t.Location = &loc
+
+	return true, nil
+}
+
+func (m *Memory) GetTruckLocations(ctx context.Context, truckID int, p PageRequest) ([]Location, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []memLocation{}
+	for _, l := range m.locations {
+		if l.TruckID == truckID {
+			rows = append(rows, l)
+		}
+	}
+
+	scanned := []Location{}
+	page, err := pageRows(keyset{"recent", []string{"recorded_at", "id"}, true}, len(rows), func(i int) []interface{} {
+		return []interface{}{rows[i].RecordedAt.UnixNano(), int64(rows[i].ID)}
+	}, p, func(i int) {
+		scanned = append(scanned, rows[i].Location)
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	locations := make([]Location, 0, len(page.rows))
+	for _, i := range page.rows {
+		locations = append(locations, scanned[i])
+	}
+	return locations, page, nil
+}
+
+func (m *Memory) CreateScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.trucks[s.TruckID]; !ok {
+		return missingRow("trucks", s.TruckID)
+	}
+	s.ID = m.nextID("truck_schedule_slots")
+	m.slots[s.ID] = *s
+	return nil
+}
+
+func (m *Memory) UpdateScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.slots[s.ID]; ok {
+		updated := *s
+		updated.TruckID = stored.TruckID
+		m.slots[s.ID] = updated
+	}
+	return nil
+}
+
+func (m *Memory) DeleteScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.slots, s.ID)
+	return nil
+}
+
+func (m *Memory) GetScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.events[e.ID]
+	if !ok {
+		return notFound("Event")
+	}
+	*e = stored
+	return nil
+}
+
+func (m *Memory) CreateScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.trucks[e.TruckID]; !ok {
+		return missingRow("trucks", e.TruckID)
+	}
+	e.ID = m.nextID("truck_schedule_events")
+	m.events[e.ID] = *e
+	return nil
+}
+
+func (m *Memory) UpdateScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if stored, ok := m.events[e.ID]; ok {
+		updated := *e
+		updated.TruckID = stored.TruckID
+		m.events[e.ID] = updated
+	}
+	return nil
+}
+
+func (m *Memory) DeleteScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.events, e.ID)
+	return nil
+}
+
+func (m *Memory) AddFavorite(ctx context.Context, userID, truckID int) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return false, missingRow("users", userID)
+	}
+	if _, ok := m.trucks[truckID]; !ok {
+		return false, missingRow("trucks", truckID)
+	}
+	for _, f := range m.favorites {
+		if f.UserID == userID && f.TruckID == truckID {
+			return false, nil
+		}
+	}
+	m.favorites = append(m.favorites, memFavorite{UserID: userID, TruckID: truckID, CreatedAt: time.Now()})
+	return true, nil
+}
+
+func (m *Memory) RemoveFavorite(ctx context.Context, userID, truckID int) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	for i, f := range m.favorites {
+		if f.UserID == userID && f.TruckID == truckID {
+			m.favorites = append(m.favorites[:i], m.favorites[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) GetFavoriteTrucks(ctx context.Context, userID int, p PageRequest) ([]Truck, Page, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, Page{}, err
+	}
+	defer m.mu.Unlock()
+
+	rows := []memFavorite{}
+	for _, f := range m.favorites {
+		if f.UserID == userID {
+			rows = append(rows, f)
+		}
+	}
+
+	scanned := []Truck{}
+	page, err := pageRows(keyset{"recent", []string{"favorited_at", "id"}, true}, len(rows), func(i int) []interface{} {
+		return []interface{}{rows[i].CreatedAt.UnixNano(), int64(rows[i].TruckID)}
+	}, p, func(i int) {
+		scanned = append(scanned, m.loadTruck(m.trucks[rows[i].TruckID]))
+	}, nil, nil)
+	if err != nil {
+		return nil, page, err
+	}
+
+	trucks := make([]Truck, 0, len(page.rows))
+	for _, i := range page.rows {
+		trucks = append(trucks, scanned[i])
+	}
+	return trucks, page, nil
+}
+
+// Copies what the trucks table and the hours tables hold of t, so later
+// changes to t's slices don't reach the store
+func storedTruck(t Truck, location *Location) Truck {
+	return Truck{
+		ID: t.ID,
+		Name: t.Name,
+		OwnerID: t.OwnerID,
+		Cell: t.Cell,
+		Address: t.Address,
+		City: t.City,
+		State: t.State,
+		Zip: t.Zip,
+		Description: t.Description,
+		Cuisines: append([]string{}, t.Cuisines...),
+		Website: t.Website,
+		SocialLinks: copyLinks(t.SocialLinks),
+		Timezone: t.timezone(),
+		Rating: t.Rating,
+		RatingCount: t.RatingCount,
+		Hours: append([]domain.Hours{}, t.Hours...),
+		HoursExceptions: append([]domain.HoursException{}, t.HoursExceptions...),
+		Location: location,
+	}
+}
+
+// Returns a copy of the stored truck with everything GetTruck loads: its
+// followers, hours in order, weekly slots and the events that
+// haven't ended
+func (m *Memory) loadTruck(stored Truck) Truck {
+	t := storedTruck(stored, nil)
+	if stored.Location != nil {
+		loc := *stored.Location
+		t.Location = &loc
+	}
+
+	for _, f := range m.favorites {
+		if f.TruckID == t.ID {
+			t.FavoriteCount++
+		}
+	}
+
+	sort.SliceStable(t.Hours, func(i, j int) bool {
+		a, b := t.Hours[i], t.Hours[j]
+		return a.Day < b.Day || (a.Day == b.Day && a.Opens < b.Opens)
+	})
+	sort.SliceStable(t.HoursExceptions, func(i, j int) bool {
+		return t.HoursExceptions[i].Date.Before(t.HoursExceptions[j].Date)
+	})
+
+	t.ScheduleSlots = []ScheduleSlot{}
+	for _, s := range m.slots {
+		if s.TruckID == t.ID {
+			t.ScheduleSlots = append(t.ScheduleSlots, s)
+		}
+	}
+	sort.Slice(t.ScheduleSlots, func(i, j int) bool {
+		a, b := t.ScheduleSlots[i], t.ScheduleSlots[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Starts != b.Starts {
+			return a.Starts < b.Starts
+		}
+		return a.ID < b.ID
+	})
+
+	now := time.Now()
+	t.Events = []ScheduleEvent{}
+	for _, e := range m.events {
+		if e.TruckID == t.ID && e.EndsAt.After(now) {
+			t.Events = append(t.Events, e)
+		}
+	}
+	sort.Slice(t.Events, func(i, j int) bool {
+		a, b := t.Events[i], t.Events[j]
+		if !a.StartsAt.Equal(b.StartsAt) {
+			return a.StartsAt.Before(b.StartsAt)
+		}
+		return a.ID < b.ID
+	})
+
+	return t
+}
+
+// Deletes the truck and everything that belongs to it
+func (m *Memory) deleteTruck(id int) {
+	delete(m.trucks, id)
+
+	locations := m.locations[:0]
+	for _, l := range m.locations {
+		if l.TruckID != id {
+			locations = append(locations, l)
+		}
+	}
+	m.locations = locations
+
+	for slotID, s := range m.slots {
+		if s.TruckID == id {
+			delete(m.slots, slotID)
+		}
+	}
+	for eventID, e := range m.events {
+		if e.TruckID == id {
+			delete(m.events, eventID)
+		}
+	}
+	for orderID, o := range m.orders {
+		if o.TruckID == id {
+			m.deleteOrder(orderID)
+		}
+	}
+	for itemID, item := range m.items {
+		if item.TruckID == id {
+			m.deleteMenuItem(itemID)
+		}
+	}
+	for menuID, menu := range m.menus {
+		if menu.TruckID == id {
+			for categoryID, c := range m.categories {
+				if c.MenuID == menuID {
+					delete(m.categories, categoryID)
+				}
+			}
+			delete(m.menus, menuID)
+		}
+	}
+	for reviewID, r := range m.reviews {
+		if r.TruckID == id {
+			delete(m.reviews, reviewID)
+		}
+	}
+
+	favorites := m.favorites[:0]
+	for _, f := range m.favorites {
+		if f.TruckID != id {
+			favorites = append(favorites, f)
+		}
+	}
+	m.favorites = favorites
+}
+
+// Weights of the fields a search looks at, as the search vector weighs them
+var searchWeights = []float64{1, 0.4, 0.2}
+
+// Ranks how well the truck matches a search, which needs every word of the
+// query in its name, cuisines or description
+func searchRank(t Truck, query string) (float64, bool) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return 0, false
+	}
+
+	fields := [][]string{
+		searchTerms(t.Name),
+		searchTerms(strings.Join(t.Cuisines, " ")),
+		searchTerms(t.Description),
+	}
+	rank := 0.0
+	for _, term := range terms {
+		found := false
+		for i, field := range fields {
+			if containsString(field, term) {
+				rank += searchWeights[i]
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// Words that don't count towards a search, like Postgres' English stop words
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true,
+}
+
+// Splits text into lowercase words without stop words and with plurals
+// reduced to the singular, roughly what the english text search config does
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := []string{}
+	for _, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = w[:len(w)-1]
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func copyLinks(links map[string]string) map[string]string {
+	copied := make(map[string]string, len(links))
+	for k, v := range links {
+		copied[k] = v
+	}
+	return copied
+}
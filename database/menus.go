@@ -0,0 +1,377 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// A truck's menu. Each truck has at most one, created the first time the
+// owner touches it
+type Menu struct {
+	ID 			int
+	TruckID 	int
+	Name 		string
+}
+
+type MenuCategory struct {
+	ID 			int
+	MenuID 		int
+	TruckID 	int
+	Name 		string
+	Position 	int
+}
+
+// A menu item. CategoryID is 0 for items that aren't in a category
+type MenuItem struct {
+	ID 			int
+	TruckID 	int
+	CategoryID 	int
+	Name 		string
+	Description string
+	PriceCents 	int
+	Available 	bool
+	DietaryTags []string
+}
+
+const menuItemColumns = "id, truck_id, category_id, name, description, price_cents, available, dietary_tags"
+
+// Loads the truck's menu. Returns a NotFound error if the truck has no menu yet
+func (pg *Postgres) GetMenu(ctx context.Context, m *Menu) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT id, name FROM menus WHERE truck_id=$1",
+		m.TruckID).Scan(&m.ID, &m.Name)
+	return translate(err, "Menu")
+}
+
+// Loads the truck's menu, creating an empty one if it doesn't exist
+func (pg *Postgres) GetOrCreateMenu(ctx context.Context, m *Menu) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO menus (truck_id) VALUES($1) ON CONFLICT (truck_id) DO UPDATE SET truck_id=EXCLUDED.truck_id RETURNING id, name",
+		m.TruckID).Scan(&m.ID, &m.Name)
+	return translate(err, "")
+}
+
+func (pg *Postgres) UpdateMenu(ctx context.Context, m *Menu) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE menus SET name=$1 WHERE id=$2", m.Name, m.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) GetMenuCategory(ctx context.Context, c *MenuCategory) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT c.menu_id, m.truck_id, c.name, c.position FROM menu_categories c JOIN menus m ON m.id = c.menu_id WHERE c.id=$1",
+		c.ID).Scan(&c.MenuID, &c.TruckID, &c.Name, &c.Position)
+	return translate(err, "Category")
+}
+
+func (pg *Postgres) CreateMenuCategory(ctx context.Context, c *MenuCategory) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO menu_categories (menu_id, name, position) VALUES($1, $2, $3) RETURNING id",
+		c.MenuID, c.Name, c.Position).Scan(&c.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) UpdateMenuCategory(ctx context.Context, c *MenuCategory) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE menu_categories SET name=$1, position=$2 WHERE id=$3",
+		c.Name, c.Position, c.ID)
+	return translate(err, "")
+}
+
+// Deletes the category. Its items stay on the menu, uncategorized
+func (pg *Postgres) DeleteMenuCategory(ctx context.Context, c *MenuCategory) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM menu_categories WHERE id=$1", c.ID)
+	return err
+}
+
+// Returns the categories of the truck's menu in display order
+func (pg *Postgres) GetMenuCategories(ctx context.Context, truckID int) ([]MenuCategory, error) {
+	rows, err := pg.db.QueryContext(ctx, "SELECT c.id, c.menu_id, m.truck_id, c.name, c.position FROM menu_categories c JOIN menus m ON m.id = c.menu_id WHERE m.truck_id=$1 ORDER BY c.position, c.id",
+		truckID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	categories := []MenuCategory{}
+
+	for rows.Next() {
+		var c MenuCategory
+		if err := rows.Scan(&c.ID, &c.MenuID, &c.TruckID, &c.Name, &c.Position); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+func (pg *Postgres) GetMenuItem(ctx context.Context, m *MenuItem) error {
+	err := scanMenuItem(pg.db.QueryRowContext(ctx, "SELECT " + menuItemColumns + " FROM menu_items WHERE id=$1", m.ID), m)
+	return translate(err, "Menu item")
+}
+
+func (pg *Postgres) CreateMenuItem(ctx context.Context, m *MenuItem) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO menu_items (truck_id, category_id, name, description, price_cents, available, dietary_tags) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		m.TruckID, nullableID(m.CategoryID), m.Name, m.Description, m.PriceCents, m.Available, pq.Array(m.DietaryTags)).Scan(&m.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) UpdateMenuItem(ctx context.Context, m *MenuItem) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE menu_items SET category_id=$1, name=$2, description=$3, price_cents=$4, available=$5, dietary_tags=$6 WHERE id=$7",
+		nullableID(m.CategoryID), m.Name, m.Description, m.PriceCents, m.Available, pq.Array(m.DietaryTags), m.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) SetMenuItemAvailable(ctx context.Context, m *MenuItem, available bool) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE menu_items SET available=$1 WHERE id=$2", available, m.ID)
+	if err == nil {
+		m.Available = available
+	}
+	return err
+}
+
+// Deletes the item. Past orders keep their copy of its name and price
+func (pg *Postgres) DeleteMenuItem(ctx context.Context, m *MenuItem) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM menu_items WHERE id=$1", m.ID)
+	return err
+}
+
+// Returns every item the truck sells, available or not
+func (pg *Postgres) GetMenuItems(ctx context.Context, truckID int) ([]MenuItem, error) {
+	rows, err := pg.db.QueryContext(ctx, "SELECT " + menuItemColumns + " FROM menu_items WHERE truck_id=$1 ORDER BY id",
+		truckID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []MenuItem{}
+
+	for rows.Next() {
+		var m MenuItem
+		if err := scanMenuItem(rows, &m); err != nil {
+			return nil, err
+		}
+		items = append(items, m)
+	}
+
+	return items, rows.Err()
+}
+
+func scanMenuItem(row rowScanner, m *MenuItem) error {
+	var categoryID sql.NullInt64
+	err := row.Scan(&m.ID, &m.TruckID, &categoryID, &m.Name, &m.Description, &m.PriceCents, &m.Available, pq.Array(&m.DietaryTags))
+	m.CategoryID = int(categoryID.Int64)
+	return err
+}
+
+// An option group on a menu item, with its options in display order
+type MenuOptionGroup struct {
+	ID 				int
+	MenuItemID 		int
+	Name 			string
+	MinSelections 	int
+	MaxSelections 	int
+	Position 		int
+	Options 		[]MenuOption
+}
+
+type MenuOption struct {
+	ID 				int
+	GroupID 		int
+	Name 			string
+	PriceDeltaCents int
+	Available 		bool
+	Position 		int
+}
+
+// The group as the ordering rules see it
+func (g MenuOptionGroup) Rules() domain.OptionGroup {
+	options := make([]domain.Option, 0, len(g.Options))
+	for _, o := range g.Options {
+		options = append(options, domain.Option{
+			ID: o.ID,
+			Name: o.Name,
+			PriceDeltaCents: o.PriceDeltaCents,
+			Available: o.Available,
+		})
+	}
+	return domain.OptionGroup{
+		ID: g.ID,
+		Name: g.Name,
+		MinSelections: g.MinSelections,
+		MaxSelections: g.MaxSelections,
+		Options: options,
+	}
+}
+
+func (pg *Postgres) GetOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT menu_item_id, name, min_selections, max_selections, position FROM menu_option_groups WHERE id=$1",
+		g.ID).Scan(&g.MenuItemID, &g.Name, &g.MinSelections, &g.MaxSelections, &g.Position)
+	if err != nil {
+		return translate(err, "Option group")
+	}
+
+	groups := []MenuOptionGroup{*g}
+	if err := loadOptions(ctx, pg.db, groups); err != nil {
+		return err
+	}
+	*g = groups[0]
+
+	return nil
+}
+
+func (pg *Postgres) CreateOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return tx.createOptionGroup(ctx, g)
+	})
+}
+
+func (pg *Postgres) createOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO menu_option_groups (menu_item_id, name, min_selections, max_selections, position) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		g.MenuItemID, g.Name, g.MinSelections, g.MaxSelections, g.Position).Scan(&g.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range g.Options {
+		g.Options[i].GroupID = g.ID
+		if err := g.Options[i].createOption(ctx, pg.db); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Updates the group and syncs its options: options with an ID are updated,
+// new ones are inserted and any the group no longer lists are deleted
+func (pg *Postgres) UpdateOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return tx.updateOptionGroup(ctx, g)
+	})
+}
+
+func (pg *Postgres) updateOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE menu_option_groups SET name=$1, min_selections=$2, max_selections=$3, position=$4 WHERE id=$5",
+		g.Name, g.MinSelections, g.MaxSelections, g.Position, g.ID)
+	if err != nil {
+		return err
+	}
+
+	keep := []int64{}
+	for _, o := range g.Options {
+		if o.ID != 0 {
+			keep = append(keep, int64(o.ID))
+		}
+	}
+	_, err = pg.db.ExecContext(ctx, "DELETE FROM menu_options WHERE group_id=$1 AND NOT (id = ANY($2))", g.ID, pq.Array(keep))
+	if err != nil {
+		return err
+	}
+
+	for i := range g.Options {
+		o := &g.Options[i]
+		o.GroupID = g.ID
+		if o.ID == 0 {
+			err = o.createOption(ctx, pg.db)
+		} else {
+			_, err = pg.db.ExecContext(ctx, "UPDATE menu_options SET name=$1, price_delta_cents=$2, available=$3, position=$4 WHERE id=$5 AND group_id=$6",
+				o.Name, o.PriceDeltaCents, o.Available, o.Position, o.ID, o.GroupID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pg *Postgres) DeleteOptionGroup(ctx context.Context, g *MenuOptionGroup) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM menu_option_groups WHERE id=$1", g.ID)
+	return err
+}
+
+func (o *MenuOption) createOption(ctx context.Context, db DBTX) error {
+	return db.QueryRowContext(ctx, "INSERT INTO menu_options (group_id, name, price_delta_cents, available, position) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		o.GroupID, o.Name, o.PriceDeltaCents, o.Available, o.Position).Scan(&o.ID)
+}
+
+// Returns the option groups of the given items, keyed by item ID
+func (pg *Postgres) GetOptionGroups(ctx context.Context, menuItemIDs []int) (map[int][]MenuOptionGroup, error) {
+	byItem := map[int][]MenuOptionGroup{}
+	if len(menuItemIDs) == 0 {
+		return byItem, nil
+	}
+
+	ids := make([]int64, len(menuItemIDs))
+	for i, id := range menuItemIDs {
+		ids[i] = int64(id)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, "SELECT id, menu_item_id, name, min_selections, max_selections, position FROM menu_option_groups WHERE menu_item_id = ANY($1) ORDER BY position, id",
+		pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []MenuOptionGroup{}
+	for rows.Next() {
+		var g MenuOptionGroup
+		if err := rows.Scan(&g.ID, &g.MenuItemID, &g.Name, &g.MinSelections, &g.MaxSelections, &g.Position); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadOptions(ctx, pg.db, groups); err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		byItem[g.MenuItemID] = append(byItem[g.MenuItemID], g)
+	}
+
+	return byItem, nil
+}
+
+// Fills in the options of every group with a single query
+func loadOptions(ctx context.Context, db DBTX, groups []MenuOptionGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(groups))
+	byID := make(map[int]*MenuOptionGroup, len(groups))
+	for i := range groups {
+		ids[i] = int64(groups[i].ID)
+		groups[i].Options = []MenuOption{}
+		byID[groups[i].ID] = &groups[i]
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, group_id, name, price_delta_cents, available, position FROM menu_options WHERE group_id = ANY($1) ORDER BY position, id",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var o MenuOption
+		if err := rows.Scan(&o.ID, &o.GroupID, &o.Name, &o.PriceDeltaCents, &o.Available, &o.Position); err != nil {
+			return err
+		}
+		g := byID[o.GroupID]
+		g.Options = append(g.Options, o)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// A line of an order. Name and price are copied from the menu item when the
+// order is placed, so later menu changes don't rewrite past orders
+type OrderItem struct {
+	ID 				int
+	OrderID 		int
+	MenuItemID 		int
+	Name 			string
+	UnitPriceCents 	int
+	Quantity 		int
+	LineTotalCents 	int
+	Options 		[]OrderItemOption
+}
+
+// A modifier chosen for an order line, snapshotted like the line itself
+type OrderItemOption struct {
+	ID 				int
+	OrderItemID 	int
+	OptionID 		int
+	GroupName 		string
+	Name 			string
+	PriceDeltaCents int
+}
+
+// A recorded status transition. FromStatus is empty for the initial placement
+type OrderStatusChange struct {
+	ID 			int
+	OrderID 	int
+	FromStatus 	string
+	ToStatus 	string
+	ChangedBy 	int
+	Reason 		string
+	ChangedAt 	time.Time
+}
+
+type Order struct {
+	ID 			int
+	UserID 		int
+	TruckID 	int
+	Status 		string
+	Notes 		string
+	TotalCents 	int
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+	Items 		[]OrderItem
+}
+
+func (pg *Postgres) GetOrder(ctx context.Context, o *Order) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT user_id, truck_id, status, notes, total_cents, created_at, updated_at FROM orders WHERE id=$1",
+		o.ID).Scan(&o.UserID, &o.TruckID, &o.Status, &o.Notes, &o.TotalCents, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return translate(err, "Order")
+	}
+
+	orders := []Order{*o}
+	if err := loadOrderItems(ctx, pg.db, orders); err != nil {
+		return err
+	}
+	*o = orders[0]
+
+	return nil
+}
+
+// Inserts the order, its items and the initial history entry. Item prices and
+// the total must already be set
+func (pg *Postgres) CreateOrder(ctx context.Context, o *Order) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return tx.createOrder(ctx, o)
+	})
+}
+
+func (pg *Postgres) createOrder(ctx context.Context, o *Order) error {
+	o.Status = domain.StatusPlaced
+
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO orders (user_id, truck_id, status, notes, total_cents) VALUES($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at",
+		o.UserID, o.TruckID, o.Status, o.Notes, o.TotalCents).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.OrderID = o.ID
+		err := pg.db.QueryRowContext(ctx, "INSERT INTO order_items (order_id, menu_item_id, name, unit_price_cents, quantity, line_total_cents) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
+			item.OrderID, nullableID(item.MenuItemID), item.Name, item.UnitPriceCents, item.Quantity, item.LineTotalCents).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+
+		for j := range item.Options {
+			opt := &item.Options[j]
+			opt.OrderItemID = item.ID
+			err := pg.db.QueryRowContext(ctx, "INSERT INTO order_item_options (order_item_id, option_id, group_name, name, price_delta_cents) VALUES($1, $2, $3, $4, $5) RETURNING id",
+				opt.OrderItemID, nullableID(opt.OptionID), opt.GroupName, opt.Name, opt.PriceDeltaCents).Scan(&opt.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = pg.db.ExecContext(ctx, "INSERT INTO order_status_history (order_id, to_status, changed_by, changed_at) VALUES($1, $2, $3, $4)",
+		o.ID, o.Status, nullableID(o.UserID), o.CreatedAt)
+
+	return err
+}
+
+// Moves the order to a new status and records the change. The update only
+// applies if the order is still in the status it was loaded with, so two
+// concurrent transitions can't both win; false means the order had moved on
+func (pg *Postgres) TransitionOrderStatus(ctx context.Context, o *Order, to string, changedBy int, reason string) (moved bool, err error) {
+	err = pg.transact(ctx, func(tx *Postgres) error {
+		moved, err = tx.transitionOrderStatus(ctx, o, to, changedBy, reason)
+		return err
+	})
+	return moved, err
+}
+
+func (pg *Postgres) transitionOrderStatus(ctx context.Context, o *Order, to string, changedBy int, reason string) (bool, error) {
+	from := o.Status
+	err := pg.db.QueryRowContext(ctx, "UPDATE orders SET status=$1, updated_at=now() WHERE id=$2 AND status=$3 RETURNING updated_at",
+		to, o.ID, from).Scan(&o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	o.Status = to
+
+	_, err = pg.db.ExecContext(ctx, "INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason, changed_at) VALUES($1, $2, $3, $4, $5, $6)",
+		o.ID, from, to, nullableID(changedBy), reason, o.UpdatedAt)
+
+	return true, err
+}
+
+// Returns the order's status changes, oldest first
+func (pg *Postgres) GetOrderHistory(ctx context.Context, orderID int) ([]OrderStatusChange, error) {
+	rows, err := pg.db.QueryContext(ctx, "SELECT id, order_id, from_status, to_status, changed_by, reason, changed_at FROM order_status_history WHERE order_id=$1 ORDER BY changed_at, id",
+		orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	history := []OrderStatusChange{}
+
+	for rows.Next() {
+		var c OrderStatusChange
+		var from sql.NullString
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.OrderID, &from, &c.ToStatus, &changedBy, &c.Reason, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		c.FromStatus = from.String
+		c.ChangedBy = int(changedBy.Int64)
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+func (pg *Postgres) DeleteOrder(ctx context.Context, o *Order) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM orders WHERE id=$1", o.ID)
+
+	return err
+}
+
+// Returns a page of the user's orders, newest first
+func (pg *Postgres) GetOrdersForUser(ctx context.Context, userID int, p PageRequest) ([]Order, Page, error) {
+	return queryOrders(ctx, pg.db, "user_id=$1", userID, p)
+}
+
+// Returns a page of the truck's orders, newest first
+func (pg *Postgres) GetOrdersForTruck(ctx context.Context, truckID int, p PageRequest) ([]Order, Page, error) {
+	return queryOrders(ctx, pg.db, "truck_id=$1", truckID, p)
+}
+
+func queryOrders(ctx context.Context, db DBTX, where string, id int, p PageRequest) ([]Order, Page, error) {
+	q := listQuery{
+		columns: "id, user_id, truck_id, status, notes, total_cents, created_at, updated_at",
+		from: "orders",
+		where: []string{where},
+		args: []interface{}{id},
+		order: keyset{"newest", []string{"id"}, true},
+	}
+
+	scanned := []Order{}
+	page, err := q.run(ctx, db, p, func(row rowScanner, keys ...interface{}) error {
+		var o Order
+		if err := row.Scan(append([]interface{}{&o.ID, &o.UserID, &o.TruckID, &o.Status, &o.Notes, &o.TotalCents, &o.CreatedAt, &o.UpdatedAt}, keys...)...); err != nil {
+			return err
+		}
+		scanned = append(scanned, o)
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+
+	orders := make([]Order, 0, len(page.rows))
+	for _, i := range page.rows {
+		orders = append(orders, scanned[i])
+	}
+
+	if err := loadOrderItems(ctx, db, orders); err != nil {
+		return nil, page, err
+	}
+
+	return orders, page, nil
+}
+
+// Fills in the items of every order with a single query
+func loadOrderItems(ctx context.Context, db DBTX, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int]*Order, len(orders))
+	for i := range orders {
+		ids[i] = int64(orders[i].ID)
+		orders[i].Items = []OrderItem{}
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, order_id, menu_item_id, name, unit_price_cents, quantity, line_total_cents FROM order_items WHERE order_id = ANY($1) ORDER BY id",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		var menuItemID sql.NullInt64
+		if err := rows.Scan(&item.ID, &item.OrderID, &menuItemID, &item.Name, &item.UnitPriceCents, &item.Quantity, &item.LineTotalCents); err != nil {
+			return err
+		}
+		item.MenuItemID = int(menuItemID.Int64)
+		item.Options = []OrderItemOption{}
+		o := byID[item.OrderID]
+		o.Items = append(o.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return loadOrderItemOptions(ctx, db, orders)
+}
+
+// Fills in the chosen options of every order line with a single query
+func loadOrderItemOptions(ctx context.Context, db DBTX, orders []Order) error {
+	ids := []int64{}
+	byID := map[int]*OrderItem{}
+	for i := range orders {
+		for j := range orders[i].Items {
+			item := &orders[i].Items[j]
+			ids = append(ids, int64(item.ID))
+			byID[item.ID] = item
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, order_item_id, option_id, group_name, name, price_delta_cents FROM order_item_options WHERE order_item_id = ANY($1) ORDER BY id",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var opt OrderItemOption
+		var optionID sql.NullInt64
+		if err := rows.Scan(&opt.ID, &opt.OrderItemID, &optionID, &opt.GroupName, &opt.Name, &opt.PriceDeltaCents); err != nil {
+			return err
+		}
+		opt.OptionID = int(optionID.Int64)
+		item := byID[opt.OrderItemID]
+		item.Options = append(item.Options, opt)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Returned by list functions when a cursor can't be decoded or was made for
+// a different order
+var ErrInvalidCursor = NewError(Validation, "invalid_cursor", "Invalid cursor")
+
+// A position in a listing: the sort key values of the row next to it. Prev
+// cursors page back towards the start
+type Cursor struct {
+	Sort 	string 			`json:"s"`
+	Keys 	[]interface{} 	`json:"k"`
+	Prev 	bool 			`json:"p,omitempty"`
+}
+
+// What page of a listing to return
+type PageRequest struct {
+	Limit 	int
+	Cursor 	*Cursor
+	// Whether to count every matching row as well
+	Total 	bool
+}
+
+// Where a listing can go from the page that was returned. Empty cursors mean
+// there's nothing more that way
+type Page struct {
+	Next 	string 	`json:"next,omitempty"`
+	Prev 	string 	`json:"prev,omitempty"`
+	Total 	*int 	`json:"total,omitempty"`
+
+	// Indexes of the scanned rows that make up the page, in order
+	rows 	[]int
+}
+
+// The order of a listing. Every key is sorted the same way and the last one
+// must be unique, so any row can be located from its keys
+type keyset struct {
+	name 	string
+	keys 	[]string
+	desc 	bool
+}
+
+// A keyset paginated query: SELECT columns FROM from WHERE where, with args
+// numbered from $1
+type listQuery struct {
+	columns string
+	from 	string
+	where 	[]string
+	args 	[]interface{}
+	order 	keyset
+}
+
+// Decodes an opaque cursor from a query string
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var c Cursor
+	if err := decoder.Decode(&c); err != nil || c.Sort == "" || len(c.Keys) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	for i, k := range c.Keys {
+		if n, ok := k.(json.Number); ok {
+			if c.Keys[i], err = n.Int64(); err != nil {
+				c.Keys[i], _ = n.Float64()
+			}
+		}
+	}
+	return &c, nil
+}
+
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Runs the query for one page. scan is called for every row with the
+// destinations of the sort keys, which it passes on after its own columns;
+// the page then lists which of the scanned rows to return
+func (q listQuery) run(ctx context.Context, db DBTX, p PageRequest, scan func(row rowScanner, keys ...interface{}) error) (Page, error) {
+	return q.runFiltered(ctx, db, p, scan, nil, nil)
+}
+
+// How many rows a filtered listing reads at a time
+const filterBatchSize = 50
+
+// Like run, but only rows that keep accepts count towards the page. Rows are
+// read in batches, and loadBatch is called with the index range of each
+// batch before keep looks at its rows. Totals count the rows before keep
+func (q listQuery) runFiltered(ctx context.Context, db DBTX, p PageRequest, scan func(row rowScanner, keys ...interface{}) error, loadBatch func(from, to int) error, keep func(i int) bool) (Page, error) {
+	count := func() (int, error) {
+		total := 0
+		err := db.QueryRowContext(ctx, "SELECT count(*) FROM " + q.from + whereClause(q.where), q.args...).Scan(&total)
+		return total, err
+	}
+	fetch := func(after []interface{}, forward bool, limit int) ([][]interface{}, error) {
+		return q.fetch(ctx, db, after, forward, limit, scan)
+	}
+	return paginate(q.order, p, count, fetch, loadBatch, keep)
+}
+
+// Reads up to limit rows past the after keys, walking forwards or backwards
+// through the order, and returns the sort keys of each
+type fetchFunc func(after []interface{}, forward bool, limit int) ([][]interface{}, error)
+
+// Builds a page from rows read with fetch, in order, whatever they're read
+// from. count is only called when the request asks for the total
+func paginate(order keyset, p PageRequest, count func() (int, error), fetch fetchFunc, loadBatch func(from, to int) error, keep func(i int) bool) (Page, error) {
+	var page Page
+
+	forward := p.Cursor == nil || !p.Cursor.Prev
+	if p.Cursor != nil && (p.Cursor.Sort != order.name || len(p.Cursor.Keys) != len(order.keys)) {
+		return page, ErrInvalidCursor
+	}
+
+	if p.Total {
+		total, err := count()
+		if err != nil {
+			return page, err
+		}
+		page.Total = &total
+	}
+
+	batchSize := p.Limit + 1
+	if keep != nil && batchSize < filterBatchSize {
+		batchSize = filterBatchSize
+	}
+
+	var keys [][]interface{}
+	var after []interface{}
+	if p.Cursor != nil {
+		after = p.Cursor.Keys
+	}
+	// One row more than the limit tells whether another page follows
+	for len(page.rows) <= p.Limit {
+		from := len(keys)
+		batch, err := fetch(after, forward, batchSize)
+		if err != nil {
+			return page, err
+		}
+		keys = append(keys, batch...)
+		if loadBatch != nil {
+			if err := loadBatch(from, len(keys)); err != nil {
+				return page, err
+			}
+		}
+		for i := from; i < len(keys) && len(page.rows) <= p.Limit; i++ {
+			if keep == nil || keep(i) {
+				page.rows = append(page.rows, i)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+
+	more := len(page.rows) > p.Limit
+	if more {
+		page.rows = page.rows[:p.Limit]
+	}
+	if !forward {
+		for i, j := 0, len(page.rows)-1; i < j; i, j = i+1, j-1 {
+			page.rows[i], page.rows[j] = page.rows[j], page.rows[i]
+		}
+	}
+	if len(page.rows) == 0 {
+		return page, nil
+	}
+
+	first := Cursor{Sort: order.name, Keys: keys[page.rows[0]], Prev: true}
+	last := Cursor{Sort: order.name, Keys: keys[page.rows[len(page.rows)-1]]}
+	if forward {
+		if more {
+			page.Next = last.String()
+		}
+		if p.Cursor != nil {
+			page.Prev = first.String()
+		}
+	} else {
+		page.Next = last.String()
+		if more {
+			page.Prev = first.String()
+		}
+	}
+	return page, nil
+}
+
+// Scans up to limit rows past the after keys, walking forwards or backwards
+// through the order, and returns the sort keys of each
+func (q listQuery) fetch(ctx context.Context, db DBTX, after []interface{}, forward bool, limit int, scan func(row rowScanner, keys ...interface{}) error) ([][]interface{}, error) {
+	desc := q.order.desc != !forward
+	where := append([]string{}, q.where...)
+	args := append([]interface{}{}, q.args...)
+	if after != nil {
+		cmp := ">"
+		if desc {
+			cmp = "<"
+		}
+		params := make([]string, len(after))
+		for i, k := range after {
+			args = append(args, k)
+			params[i] = fmt.Sprintf("$%d", len(args))
+		}
+		where = append(where, fmt.Sprintf("(%s) %s (%s)",
+			strings.Join(q.order.keys, ", "), cmp, strings.Join(params, ", ")))
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf("SELECT %s, %s FROM %s%s ORDER BY %s LIMIT $%d",
+		q.columns, strings.Join(q.order.keys, ", "), q.from, whereClause(where), orderBy(q.order.keys, desc), len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(q.order.keys))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := scan(rows, dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		keys = append(keys, values)
+	}
+
+	return keys, rows.Err()
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func orderBy(keys []string, desc bool) string {
+	dir := ""
+	if desc {
+		dir = " DESC"
+	}
+	terms := make([]string, len(keys))
+	for i, k := range keys {
+		terms[i] = k + dir
+	}
+	return strings.Join(terms, ", ")
+}
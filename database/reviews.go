@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// A customer's rating of a truck. OrderID is 0 unless the review is tied to
+// an order the customer picked up
+type Review struct {
+	ID 			int
+	TruckID 	int
+	UserID 		int
+	// The author's username, for display
+	Username 	string
+	OrderID 	int
+	Rating 		int
+	Body 		string
+	// The owner's answer, empty until they reply
+	Reply 		string
+	RepliedAt 	*time.Time
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+const (
+	reviewColumns 	= "r.id, r.truck_id, r.user_id, u.username, r.order_id, r.rating, r.body, r.reply, r.replied_at, r.created_at, r.updated_at"
+	reviewFrom 		= "reviews r JOIN users u ON u.id = r.user_id"
+)
+
+func (pg *Postgres) GetReview(ctx context.Context, r *Review) error {
+	err := scanReview(pg.db.QueryRowContext(ctx, "SELECT " + reviewColumns + " FROM " + reviewFrom + " WHERE r.id=$1", r.ID), r)
+	return translate(err, "Review")
+}
+
+// Creates the review, or replaces the author's earlier review of the same
+// truck. Returns whether it was created. A trigger on reviews keeps the
+// truck's rating up to date
+func (pg *Postgres) SaveReview(ctx context.Context, r *Review) (bool, error) {
+	var created bool
+	err := pg.db.QueryRowContext(ctx, `INSERT INTO reviews (truck_id, user_id, order_id, rating, body) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (truck_id, user_id) DO UPDATE SET order_id=EXCLUDED.order_id, rating=EXCLUDED.rating, body=EXCLUDED.body, updated_at=now()
+		RETURNING id, created_at, updated_at, xmax = 0`,
+		r.TruckID, r.UserID, nullableID(r.OrderID), r.Rating, r.Body).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt, &created)
+	return created, translate(err, "")
+}
+
+// Sets the owner's reply. An empty reply removes it
+func (pg *Postgres) SetReviewReply(ctx context.Context, r *Review, reply string) error {
+	err := pg.db.QueryRowContext(ctx, "UPDATE reviews SET reply=$1, replied_at=CASE WHEN $1 = '' THEN NULL ELSE now() END WHERE id=$2 RETURNING replied_at",
+		reply, r.ID).Scan(&r.RepliedAt)
+	return translate(err, "Review")
+}
+
+func (pg *Postgres) DeleteReview(ctx context.Context, r *Review) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM reviews WHERE id=$1", r.ID)
+
+	return translate(err, "")
+}
+
+// Returns a page of the truck's reviews, newest first
+func (pg *Postgres) GetReviews(ctx context.Context, truckID int, p PageRequest) ([]Review, Page, error) {
+	q := listQuery{
+		columns: reviewColumns,
+		from: reviewFrom,
+		where: []string{"r.truck_id=$1"},
+		args: []interface{}{truckID},
+		order: keyset{"newest", []string{"r.id"}, true},
+	}
+
+	scanned := []Review{}
+	page, err := q.run(ctx, pg.db, p, func(row rowScanner, keys ...interface{}) error {
+		var r Review
+		if err := scanReview(row, &r, keys...); err != nil {
+			return err
+		}
+		scanned = append(scanned, r)
+		return nil
+	})
+	if err != nil {
+		return nil, page, err
+	}
+
+	reviews := make([]Review, 0, len(page.rows))
+	for _, i := range page.rows {
+		reviews = append(reviews, scanned[i])
+	}
+	return reviews, page, nil
+}
+
+func scanReview(row rowScanner, r *Review, extra ...interface{}) error {
+	var orderID sql.NullInt64
+	var repliedAt sql.NullTime
+	dest := []interface{}{&r.ID, &r.TruckID, &r.UserID, &r.Username, &orderID, &r.Rating, &r.Body, &r.Reply, &repliedAt, &r.CreatedAt, &r.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	r.OrderID = int(orderID.Int64)
+	r.RepliedAt = nil
+	if repliedAt.Valid {
+		r.RepliedAt = &repliedAt.Time
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// Where the truck parks every week, in the truck's local time. Ends at or
+// before Starts means the slot runs past midnight
+type ScheduleSlot struct {
+	ID 			int
+	TruckID 	int
+	Day 		time.Weekday
+	Starts 		domain.Clock
+	Ends 		domain.Clock
+	Latitude 	float64
+	Longitude 	float64
+	Address 	string
+	Note 		string
+}
+
+// A one-off appearance such as a festival, at absolute times
+type ScheduleEvent struct {
+	ID 			int
+	TruckID 	int
+	Name 		string
+	StartsAt 	time.Time
+	EndsAt 		time.Time
+	Latitude 	float64
+	Longitude 	float64
+	Address 	string
+}
+
+const (
+	scheduleSlotColumns 	= "id, truck_id, weekday, to_char(starts_at, 'HH24:MI'), to_char(ends_at, 'HH24:MI'), latitude, longitude, address, note"
+	scheduleEventColumns 	= "id, truck_id, name, starts_at, ends_at, latitude, longitude, address"
+)
+
+func (s ScheduleSlot) Hours() domain.Hours {
+	return domain.Hours{Day: s.Day, Opens: s.Starts, Closes: s.Ends}
+}
+
+func (e ScheduleEvent) Window() domain.Window {
+	return domain.Window{Start: e.StartsAt, End: e.EndsAt}
+}
+
+// Everything that decides when the truck is open: its hours, exceptions,
+// weekly slots and upcoming events
+func (t *Truck) Schedule() domain.Schedule {
+	loc, err := time.LoadLocation(t.timezone())
+	if err != nil {
+		loc = time.UTC
+	}
+	s := domain.Schedule{Location: loc, Exceptions: t.HoursExceptions}
+	s.Weekly = append(s.Weekly, t.Hours...)
+	for _, slot := range t.ScheduleSlots {
+		s.Weekly = append(s.Weekly, slot.Hours())
+	}
+	for _, e := range t.Events {
+		s.Events = append(s.Events, e.Window())
+	}
+	return s
+}
+
+func (pg *Postgres) CreateScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO truck_schedule_slots (truck_id, weekday, starts_at, ends_at, latitude, longitude, address, note) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		s.TruckID, int(s.Day), s.Starts.String(), s.Ends.String(), s.Latitude, s.Longitude, s.Address, s.Note).Scan(&s.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) UpdateScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE truck_schedule_slots SET weekday=$1, starts_at=$2, ends_at=$3, latitude=$4, longitude=$5, address=$6, note=$7 WHERE id=$8",
+		int(s.Day), s.Starts.String(), s.Ends.String(), s.Latitude, s.Longitude, s.Address, s.Note, s.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) DeleteScheduleSlot(ctx context.Context, s *ScheduleSlot) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM truck_schedule_slots WHERE id=$1", s.ID)
+	return err
+}
+
+func scanScheduleSlot(row rowScanner, s *ScheduleSlot) error {
+	var weekday int
+	var starts, ends string
+	err := row.Scan(&s.ID, &s.TruckID, &weekday, &starts, &ends, &s.Latitude, &s.Longitude, &s.Address, &s.Note)
+	if err != nil {
+		return err
+	}
+	s.Day = time.Weekday(weekday)
+	if s.Starts, err = domain.ParseClock(starts); err != nil {
+		return err
+	}
+	s.Ends, err = domain.ParseClock(ends)
+	return err
+}
+
+func (pg *Postgres) GetScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	err := scanScheduleEvent(pg.db.QueryRowContext(ctx, "SELECT " + scheduleEventColumns + " FROM truck_schedule_events WHERE id=$1", e.ID), e)
+	return translate(err, "Event")
+}
+
+func (pg *Postgres) CreateScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO truck_schedule_events (truck_id, name, starts_at, ends_at, latitude, longitude, address) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		e.TruckID, e.Name, e.StartsAt, e.EndsAt, e.Latitude, e.Longitude, e.Address).Scan(&e.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) UpdateScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE truck_schedule_events SET name=$1, starts_at=$2, ends_at=$3, latitude=$4, longitude=$5, address=$6 WHERE id=$7",
+		e.Name, e.StartsAt, e.EndsAt, e.Latitude, e.Longitude, e.Address, e.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) DeleteScheduleEvent(ctx context.Context, e *ScheduleEvent) error {
+	_, err := pg.db.ExecContext(ctx, "DELETE FROM truck_schedule_events WHERE id=$1", e.ID)
+	return err
+}
+
+func scanScheduleEvent(row rowScanner, e *ScheduleEvent) error {
+	return row.Scan(&e.ID, &e.TruckID, &e.Name, &e.StartsAt, &e.EndsAt, &e.Latitude, &e.Longitude, &e.Address)
+}
+
+// Fills in the weekly slots and the events that haven't ended yet of every
+// truck, with one query for each
+func loadTruckSchedules(ctx context.Context, db DBTX, trucks []*Truck) error {
+	if len(trucks) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(trucks))
+	byID := make(map[int]*Truck, len(trucks))
+	for i, t := range trucks {
+		ids[i] = int64(t.ID)
+		t.ScheduleSlots = []ScheduleSlot{}
+		t.Events = []ScheduleEvent{}
+		byID[t.ID] = t
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT " + scheduleSlotColumns + " FROM truck_schedule_slots WHERE truck_id = ANY($1) ORDER BY weekday, starts_at",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ScheduleSlot
+		if err := scanScheduleSlot(rows, &s); err != nil {
+			return err
+		}
+		t := byID[s.TruckID]
+		t.ScheduleSlots = append(t.ScheduleSlots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT " + scheduleEventColumns + " FROM truck_schedule_events WHERE truck_id = ANY($1) AND ends_at > now() ORDER BY starts_at",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ScheduleEvent
+		if err := scanScheduleEvent(rows, &e); err != nil {
+			return err
+		}
+		t := byID[e.TruckID]
+		t.Events = append(t.Events, e)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// The storage the handlers depend on. Postgres backs the running API and
+// Memory backs tests that don't need a database. Methods that load a row
+// fill in the struct they're given and return a NotFound *Error if it doesn't
+// exist; the others take the fields they write from it. Writes the request is
+// to blame for, such as a taken username, fail with an *Error as well
+type Store interface {
+	UserStore
+	TruckStore
+	MenuStore
+	OrderStore
+	ReviewStore
+	TokenStore
+
+	// Reports whether the store can be reached, for the health check
+	Ping(ctx context.Context) error
+	// Runs fn as one unit of work: what it does through the store it's given
+	// is kept only if it returns nil. See Postgres.WithTx
+	WithTx(ctx context.Context, fn func(s Store) error) error
+}
+
+type UserStore interface {
+	GetUser(ctx context.Context, u *User) error
+	GetUserByUsername(ctx context.Context, u *User) error
+	GetUsers(ctx context.Context, role string, p PageRequest) ([]User, Page, error)
+	UsernameExists(ctx context.Context, username string, excludeID int) (bool, error)
+	EmailExists(ctx context.Context, email string, excludeID int) (bool, error)
+	CreateUser(ctx context.Context, u *User) error
+	UpdateUser(ctx context.Context, u *User) error
+	UpdatePassword(ctx context.Context, u *User) error
+	DeleteUser(ctx context.Context, u *User) error
+	SetHasTruck(ctx context.Context, u *User) error
+}
+
+// Trucks along with what hangs off them: locations, schedules and the users
+// following them
+type TruckStore interface {
+	GetTruck(ctx context.Context, t *Truck) error
+	GetTrucks(ctx context.Context, f TruckFilter, p PageRequest) ([]Truck, Page, error)
+	GetTrucksNear(ctx context.Context, lat, lng, radius float64, since time.Time, p PageRequest) ([]TruckDistance, Page, error)
+	CreateTruck(ctx context.Context, t *Truck) error
+	UpdateTruck(ctx context.Context, t *Truck) error
+	DeleteTruck(ctx context.Context, t *Truck) error
+
+	RecordLocation(ctx context.Context, t *Truck, loc Location) (bool, error)
+	GetTruckLocations(ctx context.Context, truckID int, p PageRequest) ([]Location, Page, error)
+
+	CreateScheduleSlot(ctx context.Context, s *ScheduleSlot) error
+	UpdateScheduleSlot(ctx context.Context, s *ScheduleSlot) error
+	DeleteScheduleSlot(ctx context.Context, s *ScheduleSlot) error
+	GetScheduleEvent(ctx context.Context, e *ScheduleEvent) error
+	CreateScheduleEvent(ctx context.Context, e *ScheduleEvent) error
+	UpdateScheduleEvent(ctx context.Context, e *ScheduleEvent) error
+	DeleteScheduleEvent(ctx context.Context, e *ScheduleEvent) error
+
+	AddFavorite(ctx context.Context, userID, truckID int) (bool, error)
+	RemoveFavorite(ctx context.Context, userID, truckID int) (bool, error)
+	GetFavoriteTrucks(ctx context.Context, userID int, p PageRequest) ([]Truck, Page, error)
+}
+
+type MenuStore interface {
+	GetMenu(ctx context.Context, m *Menu) error
+	GetOrCreateMenu(ctx context.Context, m *Menu) error
+	UpdateMenu(ctx context.Context, m *Menu) error
+
+	GetMenuCategory(ctx context.Context, c *MenuCategory) error
+	CreateMenuCategory(ctx context.Context, c *MenuCategory) error
+	UpdateMenuCategory(ctx context.Context, c *MenuCategory) error
+	DeleteMenuCategory(ctx context.Context, c *MenuCategory) error
+	GetMenuCategories(ctx context.Context, truckID int) ([]MenuCategory, error)
+
+	GetMenuItem(ctx context.Context, m *MenuItem) error
+	CreateMenuItem(ctx context.Context, m *MenuItem) error
+	UpdateMenuItem(ctx context.Context, m *MenuItem) error
+	SetMenuItemAvailable(ctx context.Context, m *MenuItem, available bool) error
+	DeleteMenuItem(ctx context.Context, m *MenuItem) error
+	GetMenuItems(ctx context.Context, truckID int) ([]MenuItem, error)
+
+	GetOptionGroup(ctx context.Context, g *MenuOptionGroup) error
+	CreateOptionGroup(ctx context.Context, g *MenuOptionGroup) error
+	UpdateOptionGroup(ctx context.Context, g *MenuOptionGroup) error
+	DeleteOptionGroup(ctx context.Context, g *MenuOptionGroup) error
+	GetOptionGroups(ctx context.Context, menuItemIDs []int) (map[int][]MenuOptionGroup, error)
+}
+
+type OrderStore interface {
+	GetOrder(ctx context.Context, o *Order) error
+	CreateOrder(ctx context.Context, o *Order) error
+	TransitionOrderStatus(ctx context.Context, o *Order, to string, changedBy int, reason string) (bool, error)
+	GetOrderHistory(ctx context.Context, orderID int) ([]OrderStatusChange, error)
+	DeleteOrder(ctx context.Context, o *Order) error
+	GetOrdersForUser(ctx context.Context, userID int, p PageRequest) ([]Order, Page, error)
+	GetOrdersForTruck(ctx context.Context, truckID int, p PageRequest) ([]Order, Page, error)
+}
+
+type ReviewStore interface {
+	GetReview(ctx context.Context, r *Review) error
+	SaveReview(ctx context.Context, r *Review) (bool, error)
+	SetReviewReply(ctx context.Context, r *Review, reply string) error
+	DeleteReview(ctx context.Context, r *Review) error
+	GetReviews(ctx context.Context, truckID int, p PageRequest) ([]Review, Page, error)
+}
+
+type TokenStore interface {
+	RevokeToken(ctx context.Context, jti string, userID int) error
+	RevokeAllTokens(ctx context.Context, userID int, cutoff time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error)
+	CreateRefreshToken(ctx context.Context, rt *RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, rt *RefreshToken) error
+	MarkRefreshTokenUsed(ctx context.Context, rt *RefreshToken) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, family string) error
+	RevokeAllRefreshTokens(ctx context.Context, userID int) error
+}
+
+// What the Postgres store runs its statements on: the database itself or a
+// transaction, both of which this is satisfied by
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// The store backed by a Postgres database with the schema in migrations
+type Postgres struct {
+	conn 	*sql.DB
+	// conn, or tx while the store is bound to a transaction
+	db 		DBTX
+	tx 		*sql.Tx
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{conn: db, db: db}
+}
+
+func (pg *Postgres) Ping(ctx context.Context) error {
+	return pg.conn.PingContext(ctx)
+}
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Store = (*Memory)(nil)
+)
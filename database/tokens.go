@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Adds a single token of the user to the denylist
+func (pg *Postgres) RevokeToken(ctx context.Context, jti string, userID int) error {
+	_, err := pg.db.ExecContext(ctx, "INSERT INTO token_denylist (jti, user_id) VALUES($1, $2) ON CONFLICT (jti) DO NOTHING",
+		jti, userID)
+
+	return err
+}
+
+// Revokes every token issued to the user before cutoff. The cutoff comes from
+// the clock that stamps tokens' issue times rather than the database's, so
+// the two compare consistently
+func (pg *Postgres) RevokeAllTokens(ctx context.Context, userID int, cutoff time.Time) error {
+	_, err := pg.db.ExecContext(ctx, `INSERT INTO token_cutoffs (user_id, not_before) VALUES($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET not_before = EXCLUDED.not_before`,
+		userID, cutoff)
+
+	return err
+}
+
+// Reports whether the token has been denylisted, either by its ID or because
+// it was issued before the latest "sign out everywhere" of the user it was
+// issued to
+func (pg *Postgres) IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := pg.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM token_denylist WHERE jti=$1)
+		OR EXISTS(SELECT 1 FROM token_cutoffs WHERE user_id=$2 AND not_before > $3)`,
+		jti, userID, issuedAt).Scan(&revoked)
+
+	return revoked, err
+}
+
+type RefreshToken struct {
+	ID 			int
+	TokenHash 	string
+	Family 		string
+	UserID 		int
+	ExpiresAt 	time.Time
+	UsedAt 		sql.NullTime
+	Revoked 	bool
+}
+
+func (pg *Postgres) CreateRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	err := pg.db.QueryRowContext(ctx, "INSERT INTO refresh_tokens (token_hash, family, user_id, expires_at) VALUES($1, $2, $3, $4) RETURNING id",
+		rt.TokenHash, rt.Family, rt.UserID, rt.ExpiresAt).Scan(&rt.ID)
+	return translate(err, "")
+}
+
+func (pg *Postgres) GetRefreshTokenByHash(ctx context.Context, rt *RefreshToken) error {
+	err := pg.db.QueryRowContext(ctx, "SELECT id, family, user_id, expires_at, used_at, revoked FROM refresh_tokens WHERE token_hash=$1",
+		rt.TokenHash).Scan(&rt.ID, &rt.Family, &rt.UserID, &rt.ExpiresAt, &rt.UsedAt, &rt.Revoked)
+	return translate(err, "Refresh token")
+}
+
+// Marks the refresh token as used. Returns false if it was already used or
+// revoked, which callers must treat as reuse
+func (pg *Postgres) MarkRefreshTokenUsed(ctx context.Context, rt *RefreshToken) (bool, error) {
+	res, err := pg.db.ExecContext(ctx, "UPDATE refresh_tokens SET used_at=now() WHERE id=$1 AND used_at IS NULL AND NOT revoked",
+		rt.ID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Revokes every refresh token descended from the same login
+func (pg *Postgres) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked=true WHERE family=$1", family)
+
+	return err
+}
+
+// Revokes every refresh token issued to the user
+func (pg *Postgres) RevokeAllRefreshTokens(ctx context.Context, userID int) error {
+	_, err := pg.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked=true WHERE user_id=$1", userID)
+
+	return err
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How many times a unit of work is tried before a serialization failure is
+// given up on and returned
+const txAttempts = 3
+
+// Runs fn in a serializable transaction with a store bound to it. The
+// transaction commits if fn returns nil and rolls back if it returns an error
+// or panics. When Postgres aborts it over a conflict with a concurrent one,
+// fn is run again from the start, so it shouldn't have effects outside the
+// store. Called on a store that's already in a transaction, fn joins it.
+// Errors come back translated like those of the store's methods
+func (pg *Postgres) WithTx(ctx context.Context, fn func(s Store) error) error {
+	return pg.transact(ctx, func(tx *Postgres) error {
+		return fn(tx)
+	})
+}
+
+func (pg *Postgres) transact(ctx context.Context, fn func(tx *Postgres) error) error {
+	if pg.tx != nil {
+		return translate(fn(pg), "")
+	}
+
+	var err error
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		if err = pg.runTx(ctx, fn); !retryable(err) || attempt == txAttempts {
+			break
+		}
+
+		// Back off a little longer each time so the conflicting
+		// transaction can finish first
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+	return translate(err, "")
+}
+
+func (pg *Postgres) runTx(ctx context.Context, fn func(tx *Postgres) error) (err error) {
+	tx, err := pg.conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(&Postgres{conn: pg.conn, db: tx, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Whether err is Postgres aborting a transaction that will likely succeed if
+// tried again: a serialization failure or a deadlock
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
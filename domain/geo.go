@@ -0,0 +1,57 @@
+package domain
+
+import "math"
+
+// Mean Earth radius used by the haversine formula, in meters
+const EarthRadiusMeters = 6371000.0
+
+// A latitude/longitude rectangle, in degrees
+type BoundingBox struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// Great-circle distance in meters between two points
+func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLng := radians(lng2 - lng1)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Returns a box that contains every point within radius meters of the center,
+// so a search can prefilter on plain column ranges before the exact distance
+// check. Near the poles or across the antimeridian the box widens to every
+// longitude rather than wrapping
+func BoundsAround(lat, lng, radiusMeters float64) BoundingBox {
+	dLat := degrees(radiusMeters / EarthRadiusMeters)
+	box := BoundingBox{
+		MinLat: math.Max(-90, lat - dLat),
+		MaxLat: math.Min(90, lat + dLat),
+		MinLng: -180,
+		MaxLng: 180,
+	}
+
+	if box.MinLat == -90 || box.MaxLat == 90 {
+		return box
+	}
+
+	// At the box's edge furthest from the equator a degree of longitude is
+	// shortest, so that latitude gives the widest span needed
+	edge := math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat))
+	dLng := degrees(radiusMeters / (EarthRadiusMeters * math.Cos(radians(edge))))
+	if lng - dLng >= -180 && lng + dLng <= 180 {
+		box.MinLng = lng - dLng
+		box.MaxLng = lng + dLng
+	}
+
+	return box
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
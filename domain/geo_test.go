@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversine(t *testing.T) {
+	// Austin to Dallas is about 293 km
+	d := Haversine(30.2672, -97.7431, 32.7767, -96.7970)
+	if math.Abs(d - 293000) > 3000 {
+		t.Errorf("Expected about 293 km. Got %.0f m", d)
+	}
+	if d := Haversine(30.2672, -97.7431, 30.2672, -97.7431); d != 0 {
+		t.Errorf("Expected zero distance to the same point. Got %f", d)
+	}
+}
+
+func TestBoundsAroundContainsRadius(t *testing.T) {
+	centers := [][2]float64{{30.2672, -97.7431}, {-33.8688, 151.2093}, {64.1466, -21.9426}, {0, 179.99}, {89.9, 0}}
+	radius := 10000.0
+
+	for _, c := range centers {
+		box := BoundsAround(c[0], c[1], radius)
+		// Walk the circle and make sure every point on it is inside the box
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			lat, lng := destination(c[0], c[1], bearing, radius)
+			const eps = 1e-9
+			inLat := lat >= box.MinLat - eps && lat <= box.MaxLat + eps
+			inLng := lng >= box.MinLng - eps && lng <= box.MaxLng + eps
+			if !inLat || !inLng {
+				t.Errorf("Point %.4f,%.4f at bearing %.0f from %v is outside %+v", lat, lng, bearing, c, box)
+				break
+			}
+		}
+	}
+}
+
+func TestBoundsAroundIsTight(t *testing.T) {
+	box := BoundsAround(30.2672, -97.7431, 1000)
+	if box.MaxLat - box.MinLat > 0.02 || box.MaxLng - box.MinLng > 0.03 {
+		t.Errorf("Expected a box about 2 km across. Got %+v", box)
+	}
+}
+
+// The point radius meters from lat,lng along bearing degrees
+func destination(lat, lng, bearing, radius float64) (float64, float64) {
+	d := radius / EarthRadiusMeters
+	b := radians(bearing)
+	lat1, lng1 := radians(lat), radians(lng)
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lng2 := lng1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	lng2 = math.Mod(degrees(lng2) + 540, 360) - 180
+	return degrees(lat2), lng2
+}
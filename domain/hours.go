@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A time of day as minutes since midnight
+type Clock int
+
+// Opening hours on one day of the week, in the truck's local time. Closes at
+// or before Opens means the truck stays open past midnight
+type Hours struct {
+	Day 	time.Weekday
+	Opens 	Clock
+	Closes 	Clock
+}
+
+// A change to the weekly hours on one date, e.g. closed for a holiday or
+// open late for an event. Date is midnight UTC of the local calendar date
+type HoursException struct {
+	Date 	time.Time
+	Closed 	bool
+	Opens 	Clock
+	Closes 	Clock
+	Note 	string
+}
+
+const DateLayout = "2006-01-02"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var ErrOverlappingHours = errors.New("opening hours overlap")
+
+// Parses a 24 hour "HH:MM" time
+func ParseClock(s string) (Clock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+	}
+	return Clock(t.Hour()*60 + t.Minute()), nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
+
+// Parses a three letter day name such as "mon"
+func ParseWeekday(s string) (time.Weekday, error) {
+	day, ok := weekdays[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("%q is not a day (sun, mon, tue, wed, thu, fri or sat)", s)
+	}
+	return day, nil
+}
+
+// The three letter name ParseWeekday accepts
+func WeekdayName(day time.Weekday) string {
+	return strings.ToLower(day.String()[:3])
+}
+
+// Parses a "YYYY-MM-DD" date
+func ParseDate(s string) (time.Time, error) {
+	d, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD)", s)
+	}
+	return d, nil
+}
+
+// The length of the interval in minutes, counting past midnight if it wraps
+func (h Hours) duration() int {
+	d := int(h.Closes - h.Opens)
+	if d <= 0 {
+		d += 24 * 60
+	}
+	return d
+}
+
+// Checks that no two intervals in a week overlap, including intervals that
+// run past midnight into the next day
+func CheckHours(hours []Hours) error {
+	type span struct{ start, end int }
+	const week = 7 * 24 * 60
+
+	spans := make([]span, 0, len(hours))
+	for _, h := range hours {
+		if h.Opens == h.Closes {
+			return fmt.Errorf("%s: opening and closing times can't be the same", WeekdayName(h.Day))
+		}
+		start := int(h.Day)*24*60 + int(h.Opens)
+		spans = append(spans, span{start, start + h.duration()})
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := range spans {
+		next := spans[(i+1)%len(spans)]
+		if i == len(spans)-1 {
+			// Saturday night can run into Sunday morning
+			next.start += week
+		}
+		if len(spans) > 1 && spans[i].end > next.start {
+			return ErrOverlappingHours
+		}
+	}
+
+	return nil
+}
+
+// Checks that every exception has hours unless it's a closure, and that no
+// date appears twice
+func CheckHoursExceptions(exceptions []HoursException) error {
+	seen := map[time.Time]bool{}
+	for _, e := range exceptions {
+		date := e.Date.Format(DateLayout)
+		if seen[e.Date] {
+			return fmt.Errorf("%s has more than one exception", date)
+		}
+		seen[e.Date] = true
+		if !e.Closed && e.Opens == e.Closes {
+			return fmt.Errorf("%s: opening and closing times can't be the same", date)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func clock(s string) Clock {
+	c, err := ParseClock(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestParseClock(t *testing.T) {
+	if c := clock("09:30"); c != 570 || c.String() != "09:30" {
+		t.Errorf("Expected 09:30 to be 570 minutes. Got %d (%s)", c, c)
+	}
+	for _, s := range []string{"24:00", "9am", "12:60", ""} {
+		if _, err := ParseClock(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestCheckHours(t *testing.T) {
+	tests := []struct {
+		name 	string
+		hours 	[]Hours
+		valid 	bool
+	}{
+		{"lunch and dinner", []Hours{
+			{time.Monday, clock("11:00"), clock("14:00")},
+			{time.Monday, clock("17:00"), clock("22:00")},
+		}, true},
+		{"late night", []Hours{
+			{time.Friday, clock("20:00"), clock("02:00")},
+			{time.Saturday, clock("11:00"), clock("15:00")},
+		}, true},
+		{"same day overlap", []Hours{
+			{time.Monday, clock("11:00"), clock("14:00")},
+			{time.Monday, clock("13:00"), clock("16:00")},
+		}, false},
+		{"past midnight overlap", []Hours{
+			{time.Friday, clock("20:00"), clock("02:00")},
+			{time.Saturday, clock("01:00"), clock("05:00")},
+		}, false},
+		{"saturday into sunday", []Hours{
+			{time.Saturday, clock("22:00"), clock("03:00")},
+			{time.Sunday, clock("02:00"), clock("10:00")},
+		}, false},
+		{"empty interval", []Hours{
+			{time.Monday, clock("11:00"), clock("11:00")},
+		}, false},
+	}
+
+	for _, test := range tests {
+		err := CheckHours(test.hours)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v. Got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestCheckHoursExceptions(t *testing.T) {
+	christmas, _ := ParseDate("2025-12-25")
+	ok := []HoursException{
+		{Date: christmas, Closed: true},
+	}
+	if err := CheckHoursExceptions(ok); err != nil {
+		t.Errorf("Expected a closure to be valid. Got %v", err)
+	}
+
+	twice := append(ok, HoursException{Date: christmas, Opens: clock("10:00"), Closes: clock("12:00")})
+	if err := CheckHoursExceptions(twice); err == nil {
+		t.Error("Expected two exceptions on one date to be rejected")
+	}
+}
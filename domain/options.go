@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A choice within an option group, e.g. "Carnitas" or "Extra guac"
+type Option struct {
+	ID 				int
+	Name 			string
+	PriceDeltaCents int
+	Available 		bool
+}
+
+// A set of options on a menu item and how many of them a customer must pick.
+// A group with MinSelections above zero is required
+type OptionGroup struct {
+	ID 				int
+	Name 			string
+	MinSelections 	int
+	MaxSelections 	int
+	Options 		[]Option
+}
+
+// An option picked for an order line, with the name of its group
+type Selection struct {
+	Group 	string
+	Option 	Option
+}
+
+var (
+	ErrUnknownOption 		= errors.New("unknown option")
+	ErrDuplicateOption 		= errors.New("option selected more than once")
+	ErrOptionUnavailable 	= errors.New("option not available")
+	ErrSelectionCount 		= errors.New("wrong number of options selected")
+)
+
+func (g OptionGroup) Required() bool {
+	return g.MinSelections > 0
+}
+
+// Checks that a group's min and max can be satisfied by its options
+func CheckGroupRules(min, max, options int) error {
+	if options == 0 {
+		return errors.New("An option group needs at least one option")
+	}
+	if min < 0 || max < 1 {
+		return errors.New("Minimum selections can't be negative and maximum must be at least 1")
+	}
+	if min > max {
+		return errors.New("Minimum selections can't be more than the maximum")
+	}
+	if min > options {
+		return errors.New("Minimum selections can't be more than the number of options")
+	}
+	return nil
+}
+
+// Matches the selected option IDs against an item's groups, enforcing every
+// group's min and max. Selections come back in group order
+func SelectOptions(groups []OptionGroup, selected []int) ([]Selection, error) {
+	chosen := make(map[int]bool, len(selected))
+	for _, id := range selected {
+		if chosen[id] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateOption, id)
+		}
+		chosen[id] = true
+	}
+
+	selections := []Selection{}
+	for _, g := range groups {
+		count := 0
+		for _, o := range g.Options {
+			if !chosen[o.ID] {
+				continue
+			}
+			if !o.Available {
+				return nil, fmt.Errorf("%w: %s", ErrOptionUnavailable, o.Name)
+			}
+			delete(chosen, o.ID)
+			selections = append(selections, Selection{Group: g.Name, Option: o})
+			count++
+		}
+
+		if count < g.MinSelections || count > g.MaxSelections {
+			if g.MinSelections == g.MaxSelections {
+				return nil, fmt.Errorf("%w: choose %d from %s", ErrSelectionCount, g.MinSelections, g.Name)
+			}
+			return nil, fmt.Errorf("%w: choose %d to %d from %s", ErrSelectionCount, g.MinSelections, g.MaxSelections, g.Name)
+		}
+	}
+
+	for id := range chosen {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownOption, id)
+	}
+
+	return selections, nil
+}
+
+// The price of one unit of an item with the given selections
+func UnitPrice(basePriceCents int, selections []Selection) int {
+	price := basePriceCents
+	for _, s := range selections {
+		price += s.Option.PriceDeltaCents
+	}
+	return price
+}
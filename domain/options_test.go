@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func burritoGroups() []OptionGroup {
+	return []OptionGroup{
+		{ID: 1, Name: "Protein", MinSelections: 1, MaxSelections: 1, Options: []Option{
+			{ID: 1, Name: "Carnitas", Available: true},
+			{ID: 2, Name: "Steak", PriceDeltaCents: 150, Available: true},
+			{ID: 3, Name: "Fish", PriceDeltaCents: 200, Available: false},
+		}},
+		{ID: 2, Name: "Extras", MinSelections: 0, MaxSelections: 2, Options: []Option{
+			{ID: 4, Name: "Guac", PriceDeltaCents: 100, Available: true},
+			{ID: 5, Name: "Queso", PriceDeltaCents: 75, Available: true},
+			{ID: 6, Name: "Jalapeños", Available: true},
+		}},
+	}
+}
+
+func TestSelectOptions(t *testing.T) {
+	tests := []struct {
+		selected 	[]int
+		price 		int
+		err 		error
+	}{
+		{[]int{1}, 850, nil},
+		{[]int{4, 2}, 1100, nil},
+		{[]int{2, 4, 5}, 1175, nil},
+		{[]int{}, 0, ErrSelectionCount},
+		{[]int{1, 2}, 0, ErrSelectionCount},
+		{[]int{1, 4, 5, 6}, 0, ErrSelectionCount},
+		{[]int{3}, 0, ErrOptionUnavailable},
+		{[]int{1, 9}, 0, ErrUnknownOption},
+		{[]int{1, 4, 4}, 0, ErrDuplicateOption},
+	}
+
+	for _, test := range tests {
+		selections, err := SelectOptions(burritoGroups(), test.selected)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%v: expected error %v. Got %v", test.selected, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: expected no error. Got %v", test.selected, err)
+			continue
+		}
+		if price := UnitPrice(850, selections); price != test.price {
+			t.Errorf("%v: expected a unit price of %d. Got %d", test.selected, test.price, price)
+		}
+	}
+}
+
+func TestCheckGroupRules(t *testing.T) {
+	tests := []struct {
+		min, max, options 	int
+		valid 				bool
+	}{
+		{1, 1, 3, true},
+		{0, 3, 3, true},
+		{0, 5, 3, true},
+		{2, 1, 3, false},
+		{4, 4, 3, false},
+		{0, 0, 3, false},
+		{0, 1, 0, false},
+	}
+
+	for _, test := range tests {
+		err := CheckGroupRules(test.min, test.max, test.options)
+		if test.valid != (err == nil) {
+			t.Errorf("min %d, max %d, %d options: expected valid=%v. Got %v", test.min, test.max, test.options, test.valid, err)
+		}
+	}
+}
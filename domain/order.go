@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Order statuses. An order moves placed → accepted → preparing → ready →
+// picked_up, or ends early as rejected or cancelled
+const (
+	StatusPlaced 	= "placed"
+	StatusAccepted 	= "accepted"
+	StatusPreparing = "preparing"
+	StatusReady 	= "ready"
+	StatusPickedUp 	= "picked_up"
+	StatusRejected 	= "rejected"
+	StatusCancelled = "cancelled"
+)
+
+// Who is asking for a status change
+type Actor int
+
+const (
+	// The customer who placed the order
+	ActorCustomer Actor = iota
+	// The truck's owner, or an admin acting for them
+	ActorTruck
+)
+
+var (
+	ErrUnknownStatus 		= errors.New("unknown order status")
+	ErrIllegalTransition 	= errors.New("illegal order status transition")
+	ErrTransitionForbidden 	= errors.New("order status transition not permitted")
+)
+
+// Legal transitions and who may make them. Customers can only back out
+// before the truck has accepted the order
+var transitions = map[string]map[string][]Actor{
+	StatusPlaced: {
+		StatusAccepted: 	{ActorTruck},
+		StatusRejected: 	{ActorTruck},
+		StatusCancelled: 	{ActorCustomer, ActorTruck},
+	},
+	StatusAccepted: {
+		StatusPreparing: 	{ActorTruck},
+		StatusCancelled: 	{ActorTruck},
+	},
+	StatusPreparing: {
+		StatusReady: 		{ActorTruck},
+		StatusCancelled: 	{ActorTruck},
+	},
+	StatusReady: {
+		StatusPickedUp: 	{ActorTruck},
+	},
+	StatusPickedUp: {},
+	StatusRejected: {},
+	StatusCancelled: {},
+}
+
+func ValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// Reports whether no further transitions are possible from the status
+func IsTerminal(status string) bool {
+	return len(transitions[status]) == 0
+}
+
+// Checks that actor may move an order from one status to another. The
+// returned error wraps ErrUnknownStatus, ErrIllegalTransition or
+// ErrTransitionForbidden
+func CheckTransition(from, to string, actor Actor) error {
+	if !ValidStatus(from) || !ValidStatus(to) {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, to)
+	}
+
+	actors, ok := transitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, to)
+	}
+
+	for _, a := range actors {
+		if a == actor {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrTransitionForbidden, from, to)
+}
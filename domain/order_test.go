@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		actor 	 Actor
+		err 	 error
+	}{
+		{StatusPlaced, StatusAccepted, ActorTruck, nil},
+		{StatusAccepted, StatusPreparing, ActorTruck, nil},
+		{StatusPreparing, StatusReady, ActorTruck, nil},
+		{StatusReady, StatusPickedUp, ActorTruck, nil},
+		{StatusPlaced, StatusCancelled, ActorCustomer, nil},
+		{StatusPlaced, StatusRejected, ActorTruck, nil},
+		{StatusReady, StatusPlaced, ActorTruck, ErrIllegalTransition},
+		{StatusPlaced, StatusReady, ActorTruck, ErrIllegalTransition},
+		{StatusPickedUp, StatusCancelled, ActorTruck, ErrIllegalTransition},
+		{StatusAccepted, StatusCancelled, ActorCustomer, ErrTransitionForbidden},
+		{StatusPlaced, StatusAccepted, ActorCustomer, ErrTransitionForbidden},
+		{StatusPlaced, "eaten", ActorTruck, ErrUnknownStatus},
+	}
+
+	for _, test := range tests {
+		err := CheckTransition(test.from, test.to, test.actor)
+		if test.err == nil && err != nil {
+			t.Errorf("Expected %s to %s to be allowed. Got '%v'", test.from, test.to, err)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("Expected %s to %s to fail with '%v'. Got '%v'", test.from, test.to, test.err, err)
+		}
+	}
+}
+
+func TestTerminalStatuses(t *testing.T) {
+	for _, status := range []string{StatusPickedUp, StatusRejected, StatusCancelled} {
+		if !IsTerminal(status) {
+			t.Errorf("Expected %s to be terminal", status)
+		}
+	}
+	if IsTerminal(StatusPlaced) {
+		t.Errorf("Expected %s not to be terminal", StatusPlaced)
+	}
+}
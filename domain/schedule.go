@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// A span of time the truck is serving
+type Window struct {
+	Start 	time.Time
+	End 	time.Time
+}
+
+// Everything that decides when a truck is open. Weekly holds the opening
+// hours and recurring schedule slots, in the truck's local time. Exceptions
+// replace the weekly entries on their date, while one-off Events are absolute
+// and always count
+type Schedule struct {
+	Location 	*time.Location
+	Weekly 		[]Hours
+	Exceptions 	[]HoursException
+	Events 		[]Window
+}
+
+// How many days ahead NextOpening looks for weekly hours. Over two weeks, so
+// a holiday closure doesn't hide the hours of the week after
+const openingHorizonDays = 15
+
+var ErrEmptyWindow = errors.New("ends must be after starts")
+
+// Checks that an event ends after it starts
+func CheckWindow(w Window) error {
+	if !w.End.After(w.Start) {
+		return ErrEmptyWindow
+	}
+	return nil
+}
+
+// The windows that start on the local calendar date of day
+func (s Schedule) windowsOn(day time.Time) []Window {
+	y, m, d := day.Date()
+	at := func(c Clock, days int) time.Time {
+		return time.Date(y, m, d + days, int(c)/60, int(c)%60, 0, 0, s.Location)
+	}
+	window := func(opens, closes Clock) Window {
+		days := 0
+		if closes <= opens {
+			days = 1
+		}
+		return Window{at(opens, 0), at(closes, days)}
+	}
+
+	date := day.Format(DateLayout)
+	for _, e := range s.Exceptions {
+		if e.Date.Format(DateLayout) == date {
+			if e.Closed {
+				return nil
+			}
+			return []Window{window(e.Opens, e.Closes)}
+		}
+	}
+
+	var windows []Window
+	for _, h := range s.Weekly {
+		if h.Day == day.Weekday() {
+			windows = append(windows, window(h.Opens, h.Closes))
+		}
+	}
+	return windows
+}
+
+// Every window that may contain or follow now: yesterday's late shifts,
+// the coming weeks of weekly hours and all events
+func (s Schedule) windows(now time.Time) []Window {
+	if s.Location == nil {
+		s.Location = time.UTC
+	}
+	local := now.In(s.Location)
+	y, m, d := local.Date()
+
+	windows := append([]Window{}, s.Events...)
+	for i := -1; i < openingHorizonDays; i++ {
+		windows = append(windows, s.windowsOn(time.Date(y, m, d + i, 12, 0, 0, 0, s.Location))...)
+	}
+	return windows
+}
+
+// Whether the truck is serving at now
+func (s Schedule) IsOpen(now time.Time) bool {
+	for _, w := range s.windows(now) {
+		if !now.Before(w.Start) && now.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// The next time after now that the truck opens, if it has hours or events
+// coming up
+func (s Schedule) NextOpening(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, w := range s.windows(now) {
+		if w.Start.After(now) && (next.IsZero() || w.Start.Before(next)) {
+			next = w.Start
+		}
+	}
+	return next, !next.IsZero()
+}
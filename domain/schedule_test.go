@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleIsOpen(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data")
+	}
+	christmas, _ := ParseDate("2025-12-25")
+	s := Schedule{
+		Location: chicago,
+		Weekly: []Hours{
+			{time.Thursday, clock("11:00"), clock("14:00")},
+			{time.Friday, clock("20:00"), clock("02:00")},
+		},
+		Exceptions: []HoursException{{Date: christmas, Closed: true}},
+	}
+
+	tests := []struct {
+		name 	string
+		at 		time.Time
+		open 	bool
+	}{
+		{"thursday lunch", time.Date(2025, 12, 18, 12, 0, 0, 0, chicago), true},
+		{"thursday lunch in utc", time.Date(2025, 12, 18, 18, 0, 0, 0, time.UTC), true},
+		{"thursday at closing", time.Date(2025, 12, 18, 14, 0, 0, 0, chicago), false},
+		{"christmas lunch", time.Date(2025, 12, 25, 12, 0, 0, 0, chicago), false},
+		{"saturday after midnight", time.Date(2025, 12, 20, 1, 30, 0, 0, chicago), true},
+		{"saturday morning", time.Date(2025, 12, 20, 9, 0, 0, 0, chicago), false},
+	}
+	for _, test := range tests {
+		if open := s.IsOpen(test.at); open != test.open {
+			t.Errorf("%s: expected open=%v. Got %v", test.name, test.open, open)
+		}
+	}
+
+	event := Window{time.Date(2025, 12, 25, 18, 0, 0, 0, chicago), time.Date(2025, 12, 25, 23, 0, 0, 0, chicago)}
+	s.Events = []Window{event}
+	if !s.IsOpen(time.Date(2025, 12, 25, 19, 0, 0, 0, chicago)) {
+		t.Error("Expected an event to open the truck on a closed day")
+	}
+}
+
+func TestScheduleNextOpening(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data")
+	}
+	christmas, _ := ParseDate("2025-12-25")
+	s := Schedule{
+		Location: chicago,
+		Weekly: []Hours{{time.Thursday, clock("11:00"), clock("14:00")}},
+		Exceptions: []HoursException{{Date: christmas, Closed: true}},
+	}
+
+	next, ok := s.NextOpening(time.Date(2025, 12, 24, 12, 0, 0, 0, chicago))
+	if want := time.Date(2026, 1, 1, 11, 0, 0, 0, chicago); !ok || !next.Equal(want) {
+		t.Errorf("Expected the next opening to skip christmas to %v. Got %v", want, next)
+	}
+
+	if _, ok := (Schedule{Location: chicago}).NextOpening(time.Now()); ok {
+		t.Error("Expected no next opening without hours or events")
+	}
+}
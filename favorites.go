@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+// Returns a page of the trucks the user follows, with their current
+// location and whether they're open
+func (a *App) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+		return
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	trucks, page, err := a.Store.GetFavoriteTrucks(r.Context(), id, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewTrucks(trucks, a.Config.Trucks.LocationStaleAfter), page)
+}
+
+// Follows a truck. Responds with a 201 the first time and a 200 after that
+func (a *App) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	userID, truckID, ok := favoriteParams(w, r)
+	if !ok {
+		return
+	}
+
+	t := database.Truck{ID: truckID}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	added, err := a.Store.AddFavorite(r.Context(), userID, truckID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	code := http.StatusOK
+	if added {
+		code = http.StatusCreated
+		t.FavoriteCount++
+	}
+	respondWithJSON(w, code, constants.SUCCESS, constants.NA, model.NewTruck(t, a.Config.Trucks.LocationStaleAfter))
+}
+
+func (a *App) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	userID, truckID, ok := favoriteParams(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := a.Store.RemoveFavorite(r.Context(), userID, truckID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !removed {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Favorite not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully removed truck " + strconv.Itoa(truckID) + " from favorites", "")
+}
+
+func favoriteParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+		return 0, 0, false
+	}
+	truckID, err := strconv.Atoi(vars["truckId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return 0, 0, false
+	}
+	return userID, truckID, true
+}
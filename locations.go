@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+// Records where the truck is now. Reports that arrive out of order go into
+// the history but don't replace a newer current location
+func (a *App) UpdateTruckLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	var req model.LocationRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	now := time.Now()
+	if err := req.Validate(now); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	t := database.Truck{ID: id}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	current, err := a.Store.RecordLocation(r.Context(), &t, req.ToLocation(now))
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	message := constants.NA
+	if !current {
+		message = "Location recorded, but a newer location is already current"
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, message, model.NewTruck(t, a.Config.Trucks.LocationStaleAfter))
+}
+
+func (a *App) GetTruckLocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	locations, page, err := a.Store.GetTruckLocations(r.Context(), id, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewTruckLocations(locations, a.Config.Trucks.LocationStaleAfter), page)
+}
+
+// Radius of a nearby search in meters, when none is given and at most
+const (
+	defaultNearbyRadius = 5000.0
+	maxNearbyRadius 	= 50000.0
+)
+
+// Finds trucks with a current location within radius meters of lat,lng,
+// nearest first. Trucks whose location has gone stale are left out
+func (a *App) GetTrucksNearby(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "lat must be a number between -90 and 90")
+		return
+	}
+	lng, err := strconv.ParseFloat(r.FormValue("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "lng must be a number between -180 and 180")
+		return
+	}
+	radius := defaultNearbyRadius
+	if v := r.FormValue("radius"); v != "" {
+		radius, err = strconv.ParseFloat(v, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "radius must be a number of meters up to " + strconv.Itoa(int(maxNearbyRadius)))
+			return
+		}
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	staleAfter := a.Config.Trucks.LocationStaleAfter
+	trucks, page, err := a.Store.GetTrucksNear(r.Context(), lat, lng, radius, time.Now().Add(-staleAfter), p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewNearbyTrucks(trucks, staleAfter), page)
+}
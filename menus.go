@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+// Returns the truck's whole menu grouped by category. Public, so customers can
+// browse before signing up
+func (a *App) GetMenu(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	t := database.Truck{ID: truckID}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	m := database.Menu{TruckID: truckID}
+	if err := a.Store.GetMenu(r.Context(), &m); err != nil && !errors.Is(err, database.ErrNotFound) {
+		renderError(w, r, err)
+		return
+	}
+
+	categories, err := a.Store.GetMenuCategories(r.Context(), truckID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	items, err := a.Store.GetMenuItems(r.Context(), truckID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	itemIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+	groups, err := a.Store.GetOptionGroups(r.Context(), itemIDs)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewMenu(m, categories, items, groups))
+}
+
+func (a *App) UpdateMenu(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	var req model.MenuRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	m := database.Menu{TruckID: truckID}
+	if err := a.Store.GetOrCreateMenu(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	m.Name = req.Name
+	if err := a.Store.UpdateMenu(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully renamed menu", "")
+}
+
+func (a *App) CreateMenuCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	var req model.MenuCategoryRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	m := database.Menu{TruckID: truckID}
+	if err := a.Store.GetOrCreateMenu(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	c := database.MenuCategory{MenuID: m.ID, TruckID: truckID}
+	req.Apply(&c)
+	if err := a.Store.CreateMenuCategory(r.Context(), &c); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewMenuCategory(c))
+}
+
+func (a *App) UpdateMenuCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.menuCategoryForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.MenuCategoryRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	req.Apply(&c)
+	if err := a.Store.UpdateMenuCategory(r.Context(), &c); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewMenuCategory(c))
+}
+
+func (a *App) DeleteMenuCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.menuCategoryForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteMenuCategory(r.Context(), &c); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted category with id " + strconv.Itoa(c.ID), "")
+}
+
+func (a *App) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	var req model.MenuItemRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	if !a.checkMenuCategory(w, r, truckID, req.CategoryID) {
+		return
+	}
+
+	m := database.MenuItem{TruckID: truckID}
+	req.Apply(&m)
+	if err := a.Store.CreateMenuItem(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewMenuItem(m, nil))
+}
+
+func (a *App) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.menuItemForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.MenuItemRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	if !a.checkMenuCategory(w, r, m.TruckID, req.CategoryID) {
+		return
+	}
+
+	req.Apply(&m)
+	if err := a.Store.UpdateMenuItem(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	a.respondWithMenuItem(w, r, m)
+}
+
+// Marks an item as available or sold out without touching the rest of it
+func (a *App) SetMenuItemAvailability(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.menuItemForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.MenuAvailabilityRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	if err := a.Store.SetMenuItemAvailable(r.Context(), &m, *req.Available); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	a.respondWithMenuItem(w, r, m)
+}
+
+func (a *App) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.menuItemForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteMenuItem(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted menu item with id " + strconv.Itoa(m.ID), "")
+}
+
+func (a *App) CreateOptionGroup(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.menuItemForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.OptionGroupRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	for _, o := range req.Options {
+		if o.ID != 0 {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "New options can't have an ID")
+			return
+		}
+	}
+
+	g := database.MenuOptionGroup{MenuItemID: m.ID}
+	req.Apply(&g)
+	if err := a.Store.CreateOptionGroup(r.Context(), &g); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewOptionGroup(g))
+}
+
+func (a *App) UpdateOptionGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := a.optionGroupForItem(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.OptionGroupRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	existing := make(map[int]bool, len(g.Options))
+	for _, o := range g.Options {
+		existing[o.ID] = true
+	}
+	for _, o := range req.Options {
+		if o.ID != 0 && !existing[o.ID] {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Option " + strconv.Itoa(o.ID) + " is not in this group")
+			return
+		}
+	}
+
+	req.Apply(&g)
+	if err := a.Store.UpdateOptionGroup(r.Context(), &g); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewOptionGroup(g))
+}
+
+func (a *App) DeleteOptionGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := a.optionGroupForItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteOptionGroup(r.Context(), &g); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted option group with id " + strconv.Itoa(g.ID), "")
+}
+
+// Responds with the item and its option groups
+func (a *App) respondWithMenuItem(w http.ResponseWriter, r *http.Request, m database.MenuItem) {
+	groups, err := a.Store.GetOptionGroups(r.Context(), []int{m.ID})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewMenuItem(m, groups[m.ID]))
+}
+
+// Loads the category named by the route, responding with a 404 if it isn't
+// on this truck's menu
+func (a *App) menuCategoryForTruck(w http.ResponseWriter, r *http.Request) (database.MenuCategory, bool) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.MenuCategory{}, false
+	}
+	categoryID, err := strconv.Atoi(vars["categoryId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid category ID")
+		return database.MenuCategory{}, false
+	}
+
+	c := database.MenuCategory{ID: categoryID}
+	if err := a.Store.GetMenuCategory(r.Context(), &c); err != nil {
+		renderError(w, r, err)
+		return database.MenuCategory{}, false
+	}
+	if c.TruckID != truckID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Category not found")
+		return database.MenuCategory{}, false
+	}
+
+	return c, true
+}
+
+// Loads the item named by the route, responding with a 404 if this truck
+// doesn't sell it
+func (a *App) menuItemForTruck(w http.ResponseWriter, r *http.Request) (database.MenuItem, bool) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.MenuItem{}, false
+	}
+	itemID, err := strconv.Atoi(vars["itemId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid menu item ID")
+		return database.MenuItem{}, false
+	}
+
+	m := database.MenuItem{ID: itemID}
+	if err := a.Store.GetMenuItem(r.Context(), &m); err != nil {
+		renderError(w, r, err)
+		return database.MenuItem{}, false
+	}
+	if m.TruckID != truckID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Menu item not found")
+		return database.MenuItem{}, false
+	}
+
+	return m, true
+}
+
+// Makes sure an item is only filed under a category of its own truck's menu.
+// A zero ID leaves the item uncategorized
+func (a *App) checkMenuCategory(w http.ResponseWriter, r *http.Request, truckID, categoryID int) bool {
+	if categoryID == 0 {
+		return true
+	}
+
+	c := database.MenuCategory{ID: categoryID}
+	err := a.Store.GetMenuCategory(r.Context(), &c)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		renderError(w, r, err)
+		return false
+	}
+	if errors.Is(err, database.ErrNotFound) || c.TruckID != truckID {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Category " + strconv.Itoa(categoryID) + " is not on this truck's menu")
+		return false
+	}
+
+	return true
+}
+
+// Loads the option group named by the route, responding with a 404 if it
+// isn't on the route's menu item
+func (a *App) optionGroupForItem(w http.ResponseWriter, r *http.Request) (database.MenuOptionGroup, bool) {
+	m, ok := a.menuItemForTruck(w, r)
+	if !ok {
+		return database.MenuOptionGroup{}, false
+	}
+
+	vars := mux.Vars(r)
+	groupID, err := strconv.Atoi(vars["groupId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid option group ID")
+		return database.MenuOptionGroup{}, false
+	}
+
+	g := database.MenuOptionGroup{ID: groupID}
+	if err := a.Store.GetOptionGroup(r.Context(), &g); err != nil {
+		renderError(w, r, err)
+		return database.MenuOptionGroup{}, false
+	}
+	if g.MenuItemID != m.ID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Option group not found")
+		return database.MenuOptionGroup{}, false
+	}
+
+	return g, true
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/config"
+	"github.com/Nagoogin/munch-bunch-rest-api/migrations"
+)
+
+const migrateUsage = "usage: munch-bunch-rest-api [-config file] migrate up | down N | status | redo"
+
+func openDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// Applies the pending schema migrations, exiting if one fails
+func migrateUp(db *sql.DB) {
+	all, err := migrations.Embedded()
+	if err != nil {
+		log.Fatal(err)
+	}
+	applied, err := migrations.New(db, all).Up(context.Background())
+	for _, m := range applied {
+		log.Printf("Applied migration %s", m)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Runs the migrate subcommand with the arguments that follow it
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	all, err := migrations.Embedded()
+	if err != nil {
+		return err
+	}
+	m := migrations.New(db, all)
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Println("Applied", mig)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Nothing to apply, the schema is up to date")
+		}
+		return err
+
+	case args[0] == "down" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("down needs the number of migrations to revert, got %q", args[1])
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, mig := range reverted {
+			fmt.Println("Reverted", mig)
+		}
+		return err
+
+	case args[0] == "redo" && len(args) == 1:
+		mig, err := m.Redo(ctx)
+		if err == nil {
+			fmt.Println("Redid", mig)
+		}
+		return err
+
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", s.Migration, applied)
+		}
+		return w.Flush()
+	}
+
+	return errors.New(migrateUsage)
+}
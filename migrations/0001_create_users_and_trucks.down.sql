@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS trucks;
+DROP TABLE IF EXISTS users;
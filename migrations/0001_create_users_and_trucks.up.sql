@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS users
+(
+id SERIAL,
+username TEXT NOT NULL,
+hash TEXT NOT NULL,
+fname TEXT NOT NULL,
+lname TEXT NOT NULL,
+email TEXT NOT NULL,
+cell TEXT NOT NULL DEFAULT '',
+hasTruck BOOLEAN NOT NULL,
+role TEXT NOT NULL DEFAULT 'customer',
+CONSTRAINT users_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS trucks
+(
+id SERIAL,
+name TEXT NOT NULL,
+owner_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+CONSTRAINT trucks_pkey PRIMARY KEY (id)
+);
+
+-- Tables created before users had roles and trucks had owners
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'customer',
+ADD COLUMN IF NOT EXISTS cell TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE trucks ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users (id) ON DELETE SET NULL;
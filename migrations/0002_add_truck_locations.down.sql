@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS trucks_location_idx;
+DROP TABLE IF EXISTS truck_locations;
+
+ALTER TABLE trucks
+DROP COLUMN IF EXISTS latitude,
+DROP COLUMN IF EXISTS longitude,
+DROP COLUMN IF EXISTS location_accuracy,
+DROP COLUMN IF EXISTS location_recorded_at;
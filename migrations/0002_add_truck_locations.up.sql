@@ -0,0 +1,21 @@
+-- trucks holds the latest location, truck_locations every one reported
+ALTER TABLE trucks
+ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION,
+ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION,
+ADD COLUMN IF NOT EXISTS location_accuracy DOUBLE PRECISION,
+ADD COLUMN IF NOT EXISTS location_recorded_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS truck_locations
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+latitude DOUBLE PRECISION NOT NULL,
+longitude DOUBLE PRECISION NOT NULL,
+accuracy DOUBLE PRECISION NOT NULL DEFAULT 0,
+recorded_at TIMESTAMPTZ NOT NULL,
+received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT truck_locations_pkey PRIMARY KEY (id)
+);
+
+-- Backs the bounding-box prefilter of nearby searches
+CREATE INDEX IF NOT EXISTS trucks_location_idx ON trucks (latitude, longitude);
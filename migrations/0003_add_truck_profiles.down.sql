@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS truck_hours_exceptions;
+DROP TABLE IF EXISTS truck_hours;
+
+ALTER TABLE trucks
+DROP COLUMN IF EXISTS cell,
+DROP COLUMN IF EXISTS address,
+DROP COLUMN IF EXISTS city,
+DROP COLUMN IF EXISTS state,
+DROP COLUMN IF EXISTS zip,
+DROP COLUMN IF EXISTS description,
+DROP COLUMN IF EXISTS cuisines,
+DROP COLUMN IF EXISTS website,
+DROP COLUMN IF EXISTS social_links,
+DROP COLUMN IF EXISTS timezone;
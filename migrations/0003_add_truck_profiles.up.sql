@@ -0,0 +1,35 @@
+ALTER TABLE trucks
+ADD COLUMN IF NOT EXISTS cell TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS address TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS zip TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS cuisines TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS website TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS social_links JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Weekly opening hours in the truck's timezone. closes_at at or before
+-- opens_at means the truck is open past midnight
+CREATE TABLE IF NOT EXISTS truck_hours
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+opens_at TIME NOT NULL,
+closes_at TIME NOT NULL,
+CONSTRAINT truck_hours_pkey PRIMARY KEY (id)
+);
+
+-- Holiday closures and one-off hours that override the weekly hours
+CREATE TABLE IF NOT EXISTS truck_hours_exceptions
+(
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+date DATE NOT NULL,
+closed BOOLEAN NOT NULL DEFAULT false,
+opens_at TIME,
+closes_at TIME,
+note TEXT NOT NULL DEFAULT '',
+CONSTRAINT truck_hours_exceptions_pkey PRIMARY KEY (truck_id, date)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS truck_schedule_events;
+DROP TABLE IF EXISTS truck_schedule_slots;
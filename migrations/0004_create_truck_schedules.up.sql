@@ -0,0 +1,28 @@
+-- Recurring weekly stops in the truck's timezone
+CREATE TABLE IF NOT EXISTS truck_schedule_slots
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+starts_at TIME NOT NULL,
+ends_at TIME NOT NULL,
+latitude DOUBLE PRECISION NOT NULL,
+longitude DOUBLE PRECISION NOT NULL,
+address TEXT NOT NULL DEFAULT '',
+note TEXT NOT NULL DEFAULT '',
+CONSTRAINT truck_schedule_slots_pkey PRIMARY KEY (id)
+);
+
+-- One-off appearances at absolute times
+CREATE TABLE IF NOT EXISTS truck_schedule_events
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+name TEXT NOT NULL,
+starts_at TIMESTAMPTZ NOT NULL,
+ends_at TIMESTAMPTZ NOT NULL CHECK (ends_at > starts_at),
+latitude DOUBLE PRECISION NOT NULL,
+longitude DOUBLE PRECISION NOT NULL,
+address TEXT NOT NULL DEFAULT '',
+CONSTRAINT truck_schedule_events_pkey PRIMARY KEY (id)
+);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS trucks_cuisines_idx;
+DROP INDEX IF EXISTS trucks_search_idx;
+DROP TRIGGER IF EXISTS trucks_search_vector ON trucks;
+DROP FUNCTION IF EXISTS trucks_search_vector();
+
+ALTER TABLE trucks
+DROP COLUMN IF EXISTS rating_avg,
+DROP COLUMN IF EXISTS rating_count,
+DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,26 @@
+ALTER TABLE trucks
+ADD COLUMN IF NOT EXISTS rating_avg DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+-- Keeps trucks.search_vector in step with the name, cuisines and description.
+-- A generated column can't be used because array_to_string isn't immutable
+CREATE OR REPLACE FUNCTION trucks_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', NEW.name), 'A') ||
+		setweight(to_tsvector('english', array_to_string(NEW.cuisines, ' ')), 'B') ||
+		setweight(to_tsvector('english', NEW.description), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trucks_search_vector ON trucks;
+CREATE TRIGGER trucks_search_vector BEFORE INSERT OR UPDATE OF name, cuisines, description ON trucks
+FOR EACH ROW EXECUTE PROCEDURE trucks_search_vector();
+
+-- Fills in the search vector of trucks created before the trigger existed
+UPDATE trucks SET name = name WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS trucks_search_idx ON trucks USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS trucks_cuisines_idx ON trucks USING GIN (cuisines);
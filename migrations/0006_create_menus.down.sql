@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS menu_options;
+DROP TABLE IF EXISTS menu_option_groups;
+DROP TABLE IF EXISTS menu_items;
+DROP TABLE IF EXISTS menu_categories;
+DROP TABLE IF EXISTS menus;
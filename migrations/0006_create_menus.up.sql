@@ -0,0 +1,62 @@
+-- One menu per truck, split into ordered categories
+CREATE TABLE IF NOT EXISTS menus
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+name TEXT NOT NULL DEFAULT 'Menu',
+CONSTRAINT menus_pkey PRIMARY KEY (id),
+CONSTRAINT menus_truck_id_key UNIQUE (truck_id)
+);
+
+CREATE TABLE IF NOT EXISTS menu_categories
+(
+id SERIAL,
+menu_id INTEGER NOT NULL REFERENCES menus (id) ON DELETE CASCADE,
+name TEXT NOT NULL,
+position INTEGER NOT NULL DEFAULT 0,
+CONSTRAINT menu_categories_pkey PRIMARY KEY (id)
+);
+
+-- Menu items are managed by truck owners; orders snapshot their prices
+CREATE TABLE IF NOT EXISTS menu_items
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+category_id INTEGER REFERENCES menu_categories (id) ON DELETE SET NULL,
+name TEXT NOT NULL,
+description TEXT NOT NULL DEFAULT '',
+price_cents INTEGER NOT NULL CHECK (price_cents >= 0),
+available BOOLEAN NOT NULL DEFAULT true,
+dietary_tags TEXT[] NOT NULL DEFAULT '{}',
+CONSTRAINT menu_items_pkey PRIMARY KEY (id)
+);
+
+-- menu_items tables created before categories
+ALTER TABLE menu_items
+ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES menu_categories (id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS dietary_tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Modifiers on a menu item, e.g. a required choice of protein or optional extras
+CREATE TABLE IF NOT EXISTS menu_option_groups
+(
+id SERIAL,
+menu_item_id INTEGER NOT NULL REFERENCES menu_items (id) ON DELETE CASCADE,
+name TEXT NOT NULL,
+min_selections INTEGER NOT NULL DEFAULT 0 CHECK (min_selections >= 0),
+max_selections INTEGER NOT NULL DEFAULT 1 CHECK (max_selections >= 1),
+position INTEGER NOT NULL DEFAULT 0,
+CONSTRAINT menu_option_groups_pkey PRIMARY KEY (id),
+CONSTRAINT menu_option_groups_selections_check CHECK (min_selections <= max_selections)
+);
+
+CREATE TABLE IF NOT EXISTS menu_options
+(
+id SERIAL,
+group_id INTEGER NOT NULL REFERENCES menu_option_groups (id) ON DELETE CASCADE,
+name TEXT NOT NULL,
+price_delta_cents INTEGER NOT NULL DEFAULT 0 CHECK (price_delta_cents >= 0),
+available BOOLEAN NOT NULL DEFAULT true,
+position INTEGER NOT NULL DEFAULT 0,
+CONSTRAINT menu_options_pkey PRIMARY KEY (id)
+);
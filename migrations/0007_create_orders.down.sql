@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_status_history;
+DROP TABLE IF EXISTS order_item_options;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
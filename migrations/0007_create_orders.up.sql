@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS orders
+(
+id SERIAL,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+status TEXT NOT NULL DEFAULT 'placed',
+notes TEXT NOT NULL DEFAULT '',
+total_cents INTEGER NOT NULL CHECK (total_cents >= 0),
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT orders_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS order_items
+(
+id SERIAL,
+order_id INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+menu_item_id INTEGER REFERENCES menu_items (id) ON DELETE SET NULL,
+name TEXT NOT NULL,
+unit_price_cents INTEGER NOT NULL CHECK (unit_price_cents >= 0),
+quantity INTEGER NOT NULL CHECK (quantity > 0),
+line_total_cents INTEGER NOT NULL CHECK (line_total_cents >= 0),
+CONSTRAINT order_items_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS order_item_options
+(
+id SERIAL,
+order_item_id INTEGER NOT NULL REFERENCES order_items (id) ON DELETE CASCADE,
+option_id INTEGER REFERENCES menu_options (id) ON DELETE SET NULL,
+group_name TEXT NOT NULL,
+name TEXT NOT NULL,
+price_delta_cents INTEGER NOT NULL,
+CONSTRAINT order_item_options_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS order_status_history
+(
+id SERIAL,
+order_id INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+from_status TEXT,
+to_status TEXT NOT NULL,
+changed_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+reason TEXT NOT NULL DEFAULT '',
+changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT order_status_history_pkey PRIMARY KEY (id)
+);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS token_denylist
+(
+jti TEXT NOT NULL,
+username TEXT NOT NULL,
+revoked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT token_denylist_pkey PRIMARY KEY (jti)
+);
+
+CREATE TABLE IF NOT EXISTS token_cutoffs
+(
+username TEXT NOT NULL,
+not_before TIMESTAMPTZ NOT NULL,
+CONSTRAINT token_cutoffs_pkey PRIMARY KEY (username)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+id SERIAL,
+token_hash TEXT NOT NULL,
+family TEXT NOT NULL,
+username TEXT NOT NULL,
+expires_at TIMESTAMPTZ NOT NULL,
+used_at TIMESTAMPTZ,
+revoked BOOLEAN NOT NULL DEFAULT false,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id),
+CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash)
+);
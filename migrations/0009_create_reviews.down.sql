@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reviews;
+
+UPDATE trucks SET rating_avg = 0, rating_count = 0;
@@ -0,0 +1,16 @@
+-- One review per customer per truck. order_id marks a verified purchase
+CREATE TABLE IF NOT EXISTS reviews
+(
+id SERIAL,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+order_id INTEGER REFERENCES orders (id) ON DELETE SET NULL,
+rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+body TEXT NOT NULL DEFAULT '',
+reply TEXT NOT NULL DEFAULT '',
+replied_at TIMESTAMPTZ,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT reviews_pkey PRIMARY KEY (id),
+CONSTRAINT reviews_truck_user_key UNIQUE (truck_id, user_id)
+);
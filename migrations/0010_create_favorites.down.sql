@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS favorites;
+DROP FUNCTION IF EXISTS favorites_count();
+
+ALTER TABLE trucks DROP COLUMN IF EXISTS favorite_count;
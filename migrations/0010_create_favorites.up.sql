@@ -0,0 +1,29 @@
+ALTER TABLE trucks ADD COLUMN IF NOT EXISTS favorite_count INTEGER NOT NULL DEFAULT 0;
+
+-- Trucks a user follows
+CREATE TABLE IF NOT EXISTS favorites
+(
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+truck_id INTEGER NOT NULL REFERENCES trucks (id) ON DELETE CASCADE,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT favorites_pkey PRIMARY KEY (user_id, truck_id)
+);
+
+CREATE INDEX IF NOT EXISTS favorites_truck_idx ON favorites (truck_id);
+
+-- Keeps trucks.favorite_count in step with favorites, including the rows
+-- removed when a user is deleted
+CREATE OR REPLACE FUNCTION favorites_count() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE trucks SET favorite_count = favorite_count + 1 WHERE id = NEW.truck_id;
+	ELSE
+		UPDATE trucks SET favorite_count = favorite_count - 1 WHERE id = OLD.truck_id;
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS favorites_count ON favorites;
+CREATE TRIGGER favorites_count AFTER INSERT OR DELETE ON favorites
+FOR EACH ROW EXECUTE PROCEDURE favorites_count();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_email_key;
+DROP INDEX IF EXISTS users_username_key;
@@ -0,0 +1,28 @@
+-- Usernames and emails were only checked before writing, which concurrent
+-- registrations could both pass. Emails compare case-insensitively.
+--
+-- Databases that already hold duplicates can't take the keys, so stop with a
+-- list of them rather than a bare unique violation. They have to be merged or
+-- renamed by hand (see the README) before the server will start
+DO $$
+DECLARE
+	usernames text;
+	emails text;
+BEGIN
+	SELECT string_agg(format('%s (ids %s)', username, ids), ', ') INTO usernames
+	FROM (SELECT username, string_agg(id::text, ', ' ORDER BY id) AS ids
+		FROM users GROUP BY username HAVING count(*) > 1) dup;
+
+	SELECT string_agg(format('%s (ids %s)', email, ids), ', ') INTO emails
+	FROM (SELECT lower(email) AS email, string_agg(id::text, ', ' ORDER BY id) AS ids
+		FROM users GROUP BY lower(email) HAVING count(*) > 1) dup;
+
+	IF usernames IS NOT NULL OR emails IS NOT NULL THEN
+		RAISE EXCEPTION 'users must have unique usernames and emails before this migration, duplicate usernames: %; duplicate emails (ignoring case): %',
+			coalesce(usernames, 'none'), coalesce(emails, 'none');
+	END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_key ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email));
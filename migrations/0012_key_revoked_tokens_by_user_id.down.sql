@@ -0,0 +1,12 @@
+ALTER TABLE token_cutoffs ADD COLUMN IF NOT EXISTS username TEXT;
+UPDATE token_cutoffs SET username = users.username FROM users WHERE users.id = token_cutoffs.user_id;
+ALTER TABLE token_cutoffs DROP CONSTRAINT IF EXISTS token_cutoffs_pkey;
+ALTER TABLE token_cutoffs DROP COLUMN IF EXISTS user_id;
+ALTER TABLE token_cutoffs ALTER COLUMN username SET NOT NULL;
+ALTER TABLE token_cutoffs ADD CONSTRAINT token_cutoffs_pkey PRIMARY KEY (username);
+
+ALTER TABLE token_denylist ADD COLUMN IF NOT EXISTS username TEXT;
+UPDATE token_denylist SET username = users.username FROM users WHERE users.id = token_denylist.user_id;
+UPDATE token_denylist SET username = '' WHERE username IS NULL;
+ALTER TABLE token_denylist DROP COLUMN IF EXISTS user_id;
+ALTER TABLE token_denylist ALTER COLUMN username SET NOT NULL;
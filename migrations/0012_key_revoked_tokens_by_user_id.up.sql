@@ -0,0 +1,15 @@
+-- Revoked tokens were filed under the username, which a rename changes while
+-- the tokens keep the old one. File them under the user's id instead, which
+-- tokens carry as their subject. Cutoffs of users renamed since can't be
+-- matched up and are dropped, the denylist is matched by jti and keeps them
+ALTER TABLE token_denylist ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+UPDATE token_denylist SET user_id = users.id FROM users WHERE users.username = token_denylist.username;
+ALTER TABLE token_denylist DROP COLUMN IF EXISTS username;
+
+ALTER TABLE token_cutoffs ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+UPDATE token_cutoffs SET user_id = users.id FROM users WHERE users.username = token_cutoffs.username;
+DELETE FROM token_cutoffs WHERE user_id IS NULL;
+ALTER TABLE token_cutoffs DROP CONSTRAINT IF EXISTS token_cutoffs_pkey;
+ALTER TABLE token_cutoffs DROP COLUMN IF EXISTS username;
+ALTER TABLE token_cutoffs ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE token_cutoffs ADD CONSTRAINT token_cutoffs_pkey PRIMARY KEY (user_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS refresh_tokens_user_idx;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS username TEXT;
+UPDATE refresh_tokens SET username = users.username FROM users WHERE users.id = refresh_tokens.user_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS user_id;
+ALTER TABLE refresh_tokens ALTER COLUMN username SET NOT NULL;
@@ -0,0 +1,10 @@
+-- Refresh tokens named their user by username, so once an account was
+-- deleted or renamed they signed in whoever took the name next. Tie them to
+-- the account instead, and drop those whose account can't be found any more
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+UPDATE refresh_tokens SET user_id = users.id FROM users WHERE users.username = refresh_tokens.username;
+DELETE FROM refresh_tokens WHERE user_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS username;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS reviews_rating ON reviews;
+DROP FUNCTION IF EXISTS reviews_rating();
+DROP FUNCTION IF EXISTS refresh_truck_rating(INTEGER);
@@ -0,0 +1,39 @@
+-- Recomputes the truck's rating from its reviews. Locking the truck first
+-- makes concurrent changes to its reviews take turns, and the update then
+-- sees every review committed before it
+CREATE OR REPLACE FUNCTION refresh_truck_rating(truck INTEGER) RETURNS void AS $$
+BEGIN
+	PERFORM 1 FROM trucks WHERE id = truck FOR UPDATE;
+	UPDATE trucks SET
+		rating_avg = coalesce((SELECT avg(rating) FROM reviews WHERE truck_id = truck), 0),
+		rating_count = (SELECT count(*) FROM reviews WHERE truck_id = truck)
+		WHERE id = truck;
+END
+$$ LANGUAGE plpgsql;
+
+-- Keeps trucks.rating_avg and rating_count in step with reviews, including
+-- the rows removed when a user is deleted
+CREATE OR REPLACE FUNCTION reviews_rating() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		PERFORM refresh_truck_rating(NEW.truck_id);
+	ELSIF TG_OP = 'DELETE' THEN
+		PERFORM refresh_truck_rating(OLD.truck_id);
+	ELSE
+		PERFORM refresh_truck_rating(OLD.truck_id);
+		IF NEW.truck_id <> OLD.truck_id THEN
+			PERFORM refresh_truck_rating(NEW.truck_id);
+		END IF;
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reviews_rating ON reviews;
+CREATE TRIGGER reviews_rating AFTER INSERT OR DELETE OR UPDATE OF truck_id, rating ON reviews
+FOR EACH ROW EXECUTE PROCEDURE reviews_rating();
+
+-- Fix the ratings left behind by users deleted before the trigger
+UPDATE trucks SET
+	rating_avg = coalesce((SELECT avg(rating) FROM reviews WHERE truck_id = trucks.id), 0),
+	rating_count = (SELECT count(*) FROM reviews WHERE truck_id = trucks.id);
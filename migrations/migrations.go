@@ -0,0 +1,300 @@
+// Package migrations holds the versioned schema changes and applies them.
+// Each change is a pair of NNNN_name.up.sql and NNNN_name.down.sql files in
+// this directory, embedded into the binary. Applied versions are recorded in
+// schema_migrations.
+//
+// The first ten migrations recreate the schema the API built on startup
+// before migrations existed. They only create what's missing, so a database
+// from that time is adopted by running them once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Returned by Redo and Down when there is nothing to revert
+var ErrNothingApplied = errors.New("no migrations have been applied")
+
+// Arbitrary, shared by every instance of the API so only one migrates at a time
+const lockKey = 4213061829
+
+const tableCreationQuery = `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+version INTEGER NOT NULL,
+name TEXT NOT NULL,
+applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+)`
+
+type Migration struct {
+	Version int
+	Name 	string
+	Up 		string
+	Down 	string
+}
+
+// A migration and when it was applied, nil while it's pending. Applied
+// migrations this build doesn't know have no Up or Down
+type Status struct {
+	Migration
+	AppliedAt 	*time.Time
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Reads the migrations in fsys, ordered by version. Every version needs
+// both an up and a down file
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		parts := fileName.FindStringSubmatch(name)
+		if parts == nil {
+			return nil, fmt.Errorf("migration file %s isn't named like 0001_name.up.sql", name)
+		}
+		version, _ := strconv.Atoi(parts[1])
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s needs an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// The migrations built into the binary
+func Embedded() ([]Migration, error) {
+	return Load(files)
+}
+
+// Applies and reverts migrations while holding a Postgres advisory lock, so
+// instances starting at the same time take turns
+type Migrator struct {
+	db 			*sql.DB
+	migrations 	[]Migration
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Applies every pending migration in version order and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]Status) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Reverts the n applied migrations with the highest versions, newest first,
+// and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]Status) error {
+		latest, err := m.latest(applied, n)
+		if err != nil {
+			return err
+		}
+		for _, mig := range latest {
+			if err := run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Reverts the newest applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	var mig Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]Status) error {
+		latest, err := m.latest(applied, 1)
+		if err != nil {
+			return err
+		}
+		mig = latest[0]
+		if err := run(ctx, conn, mig, false); err != nil {
+			return err
+		}
+		return run(ctx, conn, mig, true)
+	})
+	return mig, err
+}
+
+// Lists every migration, known or applied, in version order
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]Status) error {
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if a, ok := applied[mig.Version]; ok {
+				s.AppliedAt = a.AppliedAt
+			}
+			statuses = append(statuses, s)
+			delete(applied, mig.Version)
+		}
+		for _, s := range applied {
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, err
+}
+
+// Picks the n applied migrations with the highest versions, newest first.
+// Fails if one of them isn't in this build, since it couldn't be reverted
+func (m *Migrator) latest(applied map[int]Status, n int) ([]Migration, error) {
+	if len(applied) == 0 {
+		return nil, ErrNothingApplied
+	}
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if n > len(versions) {
+		n = len(versions)
+	}
+
+	known := make(map[int]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	latest := make([]Migration, 0, n)
+	for _, v := range versions[:n] {
+		mig, ok := known[v]
+		if !ok {
+			return nil, fmt.Errorf("migration %s is applied but not part of this build", applied[v].Migration)
+		}
+		latest = append(latest, mig)
+	}
+	return latest, nil
+}
+
+// Calls fn on a connection holding the migrations lock, with the migrations
+// applied so far
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]Status) error) error {
+	// Advisory locks belong to a session, so everything runs on one connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if _, err := conn.ExecContext(ctx, tableCreationQuery); err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	applied := map[int]Status{}
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return err
+		}
+		s.AppliedAt = &appliedAt
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return fn(conn, applied)
+}
+
+// Applies or reverts one migration and records it, in a transaction
+func run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	script, record, args := mig.Down, "DELETE FROM schema_migrations WHERE version=$1", []interface{}{mig.Version}
+	if up {
+		script, record, args = mig.Up, "INSERT INTO schema_migrations (version, name) VALUES($1, $2)", []interface{}{mig.Version, mig.Name}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %s: %w", mig, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_tacos.up.sql": 		{Data: []byte("CREATE TABLE tacos (id SERIAL)")},
+		"0002_add_tacos.down.sql": 		{Data: []byte("DROP TABLE tacos")},
+		"0001_create_trucks.up.sql": 	{Data: []byte("CREATE TABLE trucks (id SERIAL)")},
+		"0001_create_trucks.down.sql": 	{Data: []byte("DROP TABLE trucks")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations. Got %d", len(migrations))
+	}
+	if migrations[0].String() != "0001_create_trucks" || migrations[1].String() != "0002_add_tacos" {
+		t.Errorf("Expected the migrations in version order. Got %v", migrations)
+	}
+	if migrations[1].Up != "CREATE TABLE tacos (id SERIAL)" || migrations[1].Down != "DROP TABLE tacos" {
+		t.Errorf("Expected the up and down scripts of 0002. Got '%s' and '%s'", migrations[1].Up, migrations[1].Down)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name 	string
+		fsys 	fstest.MapFS
+		want 	string
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_create_trucks.up.sql": 	{Data: []byte("CREATE TABLE trucks (id SERIAL)")},
+		}, "needs an up and a down file"},
+		{"bad name", fstest.MapFS{
+			"create_trucks.sql": 			{Data: []byte("CREATE TABLE trucks (id SERIAL)")},
+		}, "isn't named like"},
+		{"two names", fstest.MapFS{
+			"0001_create_trucks.up.sql": 	{Data: []byte("CREATE TABLE trucks (id SERIAL)")},
+			"0001_make_trucks.down.sql": 	{Data: []byte("DROP TABLE trucks")},
+		}, "is named both"},
+	}
+
+	for _, test := range tests {
+		_, err := Load(test.fsys)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected an error containing '%s'. Got %v", test.name, test.want, err)
+		}
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := Embedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i + 1 {
+			t.Errorf("Expected migration versions without gaps. Got %s at position %d", m, i + 1)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// Tags an item can carry. Anything else is rejected so clients can filter on
+// a fixed vocabulary
+var DietaryTags = map[string]bool{
+	"vegetarian": true,
+	"vegan": true,
+	"gluten_free": true,
+	"dairy_free": true,
+	"nut_free": true,
+	"halal": true,
+	"kosher": true,
+	"spicy": true,
+}
+
+// A truck's menu as returned by GET /truck/{id}/menu. Items without a
+// category are listed under Uncategorized
+type Menu struct {
+	TruckID 		int 			`json:"truckId"`
+	Name 			string 			`json:"name"`
+	Categories 		[]MenuCategory 	`json:"categories"`
+	Uncategorized 	[]MenuItem 		`json:"uncategorized"`
+}
+
+type MenuCategory struct {
+	ID 			int 		`json:"id"`
+	Name 		string 		`json:"name"`
+	Position 	int 		`json:"position"`
+	Items 		[]MenuItem 	`json:"items"`
+}
+
+type MenuItem struct {
+	ID 				int 			`json:"id"`
+	CategoryID 		int 			`json:"categoryId,omitempty"`
+	Name 			string 			`json:"name"`
+	Description 	string 			`json:"description"`
+	PriceCents 		int 			`json:"priceCents"`
+	Available 		bool 			`json:"available"`
+	DietaryTags 	[]string 		`json:"dietaryTags"`
+	OptionGroups 	[]OptionGroup 	`json:"optionGroups"`
+}
+
+type OptionGroup struct {
+	ID 				int 		`json:"id"`
+	Name 			string 		`json:"name"`
+	MinSelections 	int 		`json:"minSelections"`
+	MaxSelections 	int 		`json:"maxSelections"`
+	Required 		bool 		`json:"required"`
+	Position 		int 		`json:"position"`
+	Options 		[]Option 	`json:"options"`
+}
+
+type Option struct {
+	ID 				int 	`json:"id"`
+	Name 			string 	`json:"name"`
+	PriceDeltaCents int 	`json:"priceDeltaCents"`
+	Available 		bool 	`json:"available"`
+}
+
+// Body of PUT /truck/{id}/menu
+type MenuRequest struct {
+	Name 	string 	`json:"name"`
+}
+
+// Body of POST /truck/{id}/menu/categories and PUT /truck/{id}/menu/category/{categoryId}
+type MenuCategoryRequest struct {
+	Name 		string 	`json:"name"`
+	Position 	int 	`json:"position"`
+}
+
+// Body of POST /truck/{id}/menu/items and PUT /truck/{id}/menu/item/{itemId}.
+// Available defaults to true when omitted
+type MenuItemRequest struct {
+	CategoryID 	int 		`json:"categoryId"`
+	Name 		string 		`json:"name"`
+	Description string 		`json:"description"`
+	PriceCents 	*int 		`json:"priceCents"`
+	Available 	*bool 		`json:"available"`
+	DietaryTags []string 	`json:"dietaryTags"`
+}
+
+// Body of PUT /truck/{id}/menu/item/{itemId}/availability
+type MenuAvailabilityRequest struct {
+	Available 	*bool 	`json:"available"`
+}
+
+// Body of POST /truck/{id}/menu/item/{itemId}/option-groups and
+// PUT /truck/{id}/menu/item/{itemId}/option-group/{groupId}. On update, options
+// with an ID are kept and changed, options without one are added and the rest
+// are removed
+type OptionGroupRequest struct {
+	Name 			string 			`json:"name"`
+	MinSelections 	int 			`json:"minSelections"`
+	MaxSelections 	int 			`json:"maxSelections"`
+	Position 		int 			`json:"position"`
+	Options 		[]OptionRequest `json:"options"`
+}
+
+type OptionRequest struct {
+	ID 				int 	`json:"id"`
+	Name 			string 	`json:"name"`
+	PriceDeltaCents int 	`json:"priceDeltaCents"`
+	Available 		*bool 	`json:"available"`
+}
+
+// Groups the truck's items under their categories, keeping category order.
+// groups holds each item's option groups, keyed by item ID
+func NewMenu(m database.Menu, categories []database.MenuCategory, items []database.MenuItem, groups map[int][]database.MenuOptionGroup) Menu {
+	menu := Menu{
+		TruckID: m.TruckID,
+		Name: m.Name,
+		Categories: make([]MenuCategory, 0, len(categories)),
+		Uncategorized: []MenuItem{},
+	}
+
+	index := make(map[int]int, len(categories))
+	for i, c := range categories {
+		index[c.ID] = i
+		menu.Categories = append(menu.Categories, MenuCategory{
+			ID: c.ID,
+			Name: c.Name,
+			Position: c.Position,
+			Items: []MenuItem{},
+		})
+	}
+
+	for _, item := range items {
+		if i, ok := index[item.CategoryID]; ok {
+			menu.Categories[i].Items = append(menu.Categories[i].Items, NewMenuItem(item, groups[item.ID]))
+		} else {
+			menu.Uncategorized = append(menu.Uncategorized, NewMenuItem(item, groups[item.ID]))
+		}
+	}
+
+	return menu
+}
+
+func NewMenuCategory(c database.MenuCategory) MenuCategory {
+	return MenuCategory{
+		ID: c.ID,
+		Name: c.Name,
+		Position: c.Position,
+		Items: []MenuItem{},
+	}
+}
+
+func NewMenuItem(m database.MenuItem, groups []database.MenuOptionGroup) MenuItem {
+	tags := m.DietaryTags
+	if tags == nil {
+		tags = []string{}
+	}
+	optionGroups := make([]OptionGroup, 0, len(groups))
+	for _, g := range groups {
+		optionGroups = append(optionGroups, NewOptionGroup(g))
+	}
+	return MenuItem{
+		ID: m.ID,
+		CategoryID: m.CategoryID,
+		Name: m.Name,
+		Description: m.Description,
+		PriceCents: m.PriceCents,
+		Available: m.Available,
+		DietaryTags: tags,
+		OptionGroups: optionGroups,
+	}
+}
+
+func NewOptionGroup(g database.MenuOptionGroup) OptionGroup {
+	options := make([]Option, 0, len(g.Options))
+	for _, o := range g.Options {
+		options = append(options, Option{
+			ID: o.ID,
+			Name: o.Name,
+			PriceDeltaCents: o.PriceDeltaCents,
+			Available: o.Available,
+		})
+	}
+	return OptionGroup{
+		ID: g.ID,
+		Name: g.Name,
+		MinSelections: g.MinSelections,
+		MaxSelections: g.MaxSelections,
+		Required: g.Rules().Required(),
+		Position: g.Position,
+		Options: options,
+	}
+}
+
+func (r MenuRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("Menu name is required")
+	}
+	return nil
+}
+
+func (r MenuCategoryRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("Category name is required")
+	}
+	return nil
+}
+
+func (r MenuCategoryRequest) Apply(c *database.MenuCategory) {
+	c.Name = strings.TrimSpace(r.Name)
+	c.Position = r.Position
+}
+
+func (r MenuItemRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("Item name is required")
+	}
+	if r.PriceCents == nil {
+		return fmt.Errorf("Price is required")
+	}
+	if *r.PriceCents < 0 {
+		return fmt.Errorf("Price can't be negative")
+	}
+	if r.CategoryID < 0 {
+		return fmt.Errorf("Invalid category ID")
+	}
+	for _, tag := range r.DietaryTags {
+		if !DietaryTags[normalizeTag(tag)] {
+			return fmt.Errorf("Unknown dietary tag '%s'", tag)
+		}
+	}
+	return nil
+}
+
+// Copies the request onto a menu item row. Tags are normalized, deduplicated
+// and sorted
+func (r MenuItemRequest) Apply(m *database.MenuItem) {
+	m.CategoryID = r.CategoryID
+	m.Name = strings.TrimSpace(r.Name)
+	m.Description = strings.TrimSpace(r.Description)
+	m.PriceCents = *r.PriceCents
+	m.Available = r.Available == nil || *r.Available
+
+	seen := map[string]bool{}
+	m.DietaryTags = []string{}
+	for _, tag := range r.DietaryTags {
+		tag = normalizeTag(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			m.DietaryTags = append(m.DietaryTags, tag)
+		}
+	}
+	sort.Strings(m.DietaryTags)
+}
+
+func (r MenuAvailabilityRequest) Validate() error {
+	if r.Available == nil {
+		return fmt.Errorf("Availability is required")
+	}
+	return nil
+}
+
+func (r OptionGroupRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("Option group name is required")
+	}
+	if err := domain.CheckGroupRules(r.MinSelections, r.MaxSelections, len(r.Options)); err != nil {
+		return err
+	}
+	for _, o := range r.Options {
+		if strings.TrimSpace(o.Name) == "" {
+			return fmt.Errorf("Option name is required")
+		}
+		if o.PriceDeltaCents < 0 {
+			return fmt.Errorf("Option price can't be negative")
+		}
+	}
+	return nil
+}
+
+// Copies the request onto an option group row. Options default to available
+func (r OptionGroupRequest) Apply(g *database.MenuOptionGroup) {
+	g.Name = strings.TrimSpace(r.Name)
+	g.MinSelections = r.MinSelections
+	g.MaxSelections = r.MaxSelections
+	g.Position = r.Position
+	g.Options = make([]database.MenuOption, 0, len(r.Options))
+	for i, o := range r.Options {
+		g.Options = append(g.Options, database.MenuOption{
+			ID: o.ID,
+			GroupID: g.ID,
+			Name: strings.TrimSpace(o.Name),
+			PriceDeltaCents: o.PriceDeltaCents,
+			Available: o.Available == nil || *o.Available,
+			Position: i,
+		})
+	}
+}
+
+func normalizeTag(tag string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "-", "_")
+}
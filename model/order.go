@@ -0,0 +1,166 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+const MaxItemQuantity = 99
+
+// An order as returned by the API. Prices are integer cents
+type Order struct {
+	ID 			int 			`json:"id"`
+	UserID 		int 			`json:"userId"`
+	TruckID 	int 			`json:"truckId"`
+	Status 		string 			`json:"status"`
+	Notes 		string 			`json:"notes"`
+	TotalCents 	int 			`json:"totalCents"`
+	Items 		[]OrderItem 	`json:"items"`
+	CreatedAt 	time.Time 		`json:"createdAt"`
+	UpdatedAt 	time.Time 		`json:"updatedAt"`
+}
+
+// An order line. UnitPriceCents includes the chosen options
+type OrderItem struct {
+	ID 				int 				`json:"id"`
+	MenuItemID 		int 				`json:"menuItemId"`
+	Name 			string 				`json:"name"`
+	UnitPriceCents 	int 				`json:"unitPriceCents"`
+	Quantity 		int 				`json:"quantity"`
+	LineTotalCents 	int 				`json:"lineTotalCents"`
+	Options 		[]OrderItemOption 	`json:"options"`
+}
+
+type OrderItemOption struct {
+	OptionID 		int 	`json:"optionId"`
+	Group 			string 	`json:"group"`
+	Name 			string 	`json:"name"`
+	PriceDeltaCents int 	`json:"priceDeltaCents"`
+}
+
+// Body of POST /truck/{id}/orders. Prices are never taken from the client
+type OrderRequest struct {
+	Items 	[]OrderItemRequest 	`json:"items"`
+	Notes 	string 				`json:"notes"`
+}
+
+// Options lists the IDs of the chosen modifiers
+type OrderItemRequest struct {
+	MenuItemID 	int 	`json:"menuItemId"`
+	Quantity 	int 	`json:"quantity"`
+	Options 	[]int 	`json:"options"`
+}
+
+// Body of PUT /truck/{id}/order/{orderId}
+type OrderStatusRequest struct {
+	Status 	string 	`json:"status"`
+	Reason 	string 	`json:"reason"`
+}
+
+type OrderStatusChange struct {
+	FromStatus 	string 		`json:"fromStatus,omitempty"`
+	ToStatus 	string 		`json:"toStatus"`
+	ChangedBy 	int 		`json:"changedBy,omitempty"`
+	Reason 		string 		`json:"reason,omitempty"`
+	ChangedAt 	time.Time 	`json:"changedAt"`
+}
+
+func NewOrder(o database.Order) Order {
+	items := make([]OrderItem, 0, len(o.Items))
+	for _, item := range o.Items {
+		options := make([]OrderItemOption, 0, len(item.Options))
+		for _, opt := range item.Options {
+			options = append(options, OrderItemOption{
+				OptionID: opt.OptionID,
+				Group: opt.GroupName,
+				Name: opt.Name,
+				PriceDeltaCents: opt.PriceDeltaCents,
+			})
+		}
+		items = append(items, OrderItem{
+			ID: item.ID,
+			MenuItemID: item.MenuItemID,
+			Name: item.Name,
+			UnitPriceCents: item.UnitPriceCents,
+			Quantity: item.Quantity,
+			LineTotalCents: item.LineTotalCents,
+			Options: options,
+		})
+	}
+
+	return Order{
+		ID: o.ID,
+		UserID: o.UserID,
+		TruckID: o.TruckID,
+		Status: o.Status,
+		Notes: o.Notes,
+		TotalCents: o.TotalCents,
+		Items: items,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+func NewOrders(rows []database.Order) []Order {
+	orders := make([]Order, 0, len(rows))
+	for _, o := range rows {
+		orders = append(orders, NewOrder(o))
+	}
+	return orders
+}
+
+func NewOrderHistory(rows []database.OrderStatusChange) []OrderStatusChange {
+	history := make([]OrderStatusChange, 0, len(rows))
+	for _, c := range rows {
+		history = append(history, OrderStatusChange{
+			FromStatus: c.FromStatus,
+			ToStatus: c.ToStatus,
+			ChangedBy: c.ChangedBy,
+			Reason: c.Reason,
+			ChangedAt: c.ChangedAt,
+		})
+	}
+	return history
+}
+
+func (r OrderRequest) Validate() error {
+	if len(r.Items) == 0 {
+		return fmt.Errorf("An order needs at least one item")
+	}
+	for _, item := range r.Items {
+		if item.MenuItemID <= 0 {
+			return fmt.Errorf("Invalid menu item ID")
+		}
+		if item.Quantity < 1 || item.Quantity > MaxItemQuantity {
+			return fmt.Errorf("Quantity must be between 1 and %d", MaxItemQuantity)
+		}
+	}
+	return nil
+}
+
+// Builds an order line, snapshotting the menu item's current name and price
+// and the chosen options
+func NewOrderLine(m database.MenuItem, quantity int, selections []domain.Selection) database.OrderItem {
+	options := make([]database.OrderItemOption, 0, len(selections))
+	for _, s := range selections {
+		options = append(options, database.OrderItemOption{
+			OptionID: s.Option.ID,
+			GroupName: s.Group,
+			Name: s.Option.Name,
+			PriceDeltaCents: s.Option.PriceDeltaCents,
+		})
+	}
+
+	unitPrice := domain.UnitPrice(m.PriceCents, selections)
+	return database.OrderItem{
+		MenuItemID: m.ID,
+		Name: m.Name,
+		UnitPriceCents: unitPrice,
+		Quantity: quantity,
+		LineTotalCents: unitPrice * quantity,
+		Options: options,
+	}
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+)
+
+const (
+	MaxReviewLength = 2000
+	MaxReplyLength 	= 1000
+)
+
+// A review as returned by the API. VerifiedPurchase is set when the review
+// is tied to an order the customer picked up
+type Review struct {
+	ID 					int 		`json:"id"`
+	TruckID 			int 		`json:"truckId"`
+	UserID 				int 		`json:"userId"`
+	Username 			string 		`json:"username"`
+	Rating 				int 		`json:"rating"`
+	Body 				string 		`json:"body"`
+	VerifiedPurchase 	bool 		`json:"verifiedPurchase"`
+	OrderID 			int 		`json:"orderId,omitempty"`
+	Reply 				string 		`json:"reply,omitempty"`
+	RepliedAt 			*time.Time 	`json:"repliedAt,omitempty"`
+	CreatedAt 			time.Time 	`json:"createdAt"`
+	UpdatedAt 			time.Time 	`json:"updatedAt"`
+}
+
+// Body of PUT /truck/{id}/review. OrderID is optional
+type ReviewRequest struct {
+	Rating 	int 	`json:"rating"`
+	Body 	string 	`json:"body"`
+	OrderID int 	`json:"orderId"`
+}
+
+// Body of PUT /truck/{id}/review/{reviewId}/reply. An empty reply removes it
+type ReviewReplyRequest struct {
+	Reply 	string 	`json:"reply"`
+}
+
+func NewReview(r database.Review) Review {
+	return Review{
+		ID: r.ID,
+		TruckID: r.TruckID,
+		UserID: r.UserID,
+		Username: r.Username,
+		Rating: r.Rating,
+		Body: r.Body,
+		VerifiedPurchase: r.OrderID != 0,
+		OrderID: r.OrderID,
+		Reply: r.Reply,
+		RepliedAt: r.RepliedAt,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+func NewReviews(rows []database.Review) []Review {
+	reviews := make([]Review, 0, len(rows))
+	for _, r := range rows {
+		reviews = append(reviews, NewReview(r))
+	}
+	return reviews
+}
+
+func (r ReviewRequest) Validate() error {
+	if r.Rating < 1 || r.Rating > 5 {
+		return fmt.Errorf("Rating must be between 1 and 5")
+	}
+	if len(r.Body) > MaxReviewLength {
+		return fmt.Errorf("A review can be at most %d characters", MaxReviewLength)
+	}
+	if r.OrderID < 0 {
+		return fmt.Errorf("Invalid order ID")
+	}
+	return nil
+}
+
+func (r ReviewRequest) Apply(review *database.Review) {
+	review.Rating = r.Rating
+	review.Body = strings.TrimSpace(r.Body)
+	review.OrderID = r.OrderID
+}
+
+func (r ReviewReplyRequest) Validate() error {
+	if len(r.Reply) > MaxReplyLength {
+		return fmt.Errorf("A reply can be at most %d characters", MaxReplyLength)
+	}
+	return nil
+}
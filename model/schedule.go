@@ -0,0 +1,156 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+// Where and when a truck serves, as returned by GET /truck/{id}/schedule
+type Schedule struct {
+	Timezone 	string 			`json:"timezone"`
+	Slots 		[]ScheduleSlot 	`json:"slots"`
+	Events 		[]ScheduleEvent `json:"events"`
+}
+
+// A weekly stop, with times in the truck's timezone
+type ScheduleSlot struct {
+	ID 			int 	`json:"id"`
+	Day 		string 	`json:"day"`
+	Starts 		string 	`json:"starts"`
+	Ends 		string 	`json:"ends"`
+	Latitude 	float64 `json:"lat"`
+	Longitude 	float64 `json:"lng"`
+	Address 	string 	`json:"address"`
+	Note 		string 	`json:"note"`
+}
+
+type ScheduleEvent struct {
+	ID 			int 		`json:"id"`
+	Name 		string 		`json:"name"`
+	StartsAt 	time.Time 	`json:"startsAt"`
+	EndsAt 		time.Time 	`json:"endsAt"`
+	Latitude 	float64 	`json:"lat"`
+	Longitude 	float64 	`json:"lng"`
+	Address 	string 		`json:"address"`
+}
+
+// Body of POST /truck/{id}/schedule/slots and PUT /truck/{id}/schedule/slot/{slotId}
+type ScheduleSlotRequest struct {
+	Day 		string 		`json:"day"`
+	Starts 		string 		`json:"starts"`
+	Ends 		string 		`json:"ends"`
+	Latitude 	*float64 	`json:"lat"`
+	Longitude 	*float64 	`json:"lng"`
+	Address 	string 		`json:"address"`
+	Note 		string 		`json:"note"`
+}
+
+// Body of POST /truck/{id}/schedule/events and PUT /truck/{id}/schedule/event/{eventId}
+type ScheduleEventRequest struct {
+	Name 		string 		`json:"name"`
+	StartsAt 	*time.Time 	`json:"startsAt"`
+	EndsAt 		*time.Time 	`json:"endsAt"`
+	Latitude 	*float64 	`json:"lat"`
+	Longitude 	*float64 	`json:"lng"`
+	Address 	string 		`json:"address"`
+}
+
+func NewSchedule(t database.Truck) Schedule {
+	schedule := Schedule{
+		Timezone: t.Timezone,
+		Slots: make([]ScheduleSlot, 0, len(t.ScheduleSlots)),
+		Events: make([]ScheduleEvent, 0, len(t.Events)),
+	}
+	for _, s := range t.ScheduleSlots {
+		schedule.Slots = append(schedule.Slots, NewScheduleSlot(s))
+	}
+	for _, e := range t.Events {
+		schedule.Events = append(schedule.Events, NewScheduleEvent(e))
+	}
+	return schedule
+}
+
+func NewScheduleSlot(s database.ScheduleSlot) ScheduleSlot {
+	return ScheduleSlot{
+		ID: s.ID,
+		Day: domain.WeekdayName(s.Day),
+		Starts: s.Starts.String(),
+		Ends: s.Ends.String(),
+		Latitude: s.Latitude,
+		Longitude: s.Longitude,
+		Address: s.Address,
+		Note: s.Note,
+	}
+}
+
+func NewScheduleEvent(e database.ScheduleEvent) ScheduleEvent {
+	return ScheduleEvent{
+		ID: e.ID,
+		Name: e.Name,
+		StartsAt: e.StartsAt,
+		EndsAt: e.EndsAt,
+		Latitude: e.Latitude,
+		Longitude: e.Longitude,
+		Address: e.Address,
+	}
+}
+
+// Validates the request and copies it onto a slot row
+func (r ScheduleSlotRequest) Apply(s *database.ScheduleSlot) error {
+	day, err := domain.ParseWeekday(r.Day)
+	if err != nil {
+		return err
+	}
+	starts, err := domain.ParseClock(r.Starts)
+	if err != nil {
+		return err
+	}
+	ends, err := domain.ParseClock(r.Ends)
+	if err != nil {
+		return err
+	}
+	if starts == ends {
+		return fmt.Errorf("A slot can't start and end at the same time")
+	}
+	if err := checkCoordinates(r.Latitude, r.Longitude); err != nil {
+		return err
+	}
+
+	s.Day = day
+	s.Starts = starts
+	s.Ends = ends
+	s.Latitude = *r.Latitude
+	s.Longitude = *r.Longitude
+	s.Address = strings.TrimSpace(r.Address)
+	s.Note = strings.TrimSpace(r.Note)
+	return nil
+}
+
+func (r ScheduleEventRequest) Validate(now time.Time) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("Event name is required")
+	}
+	if r.StartsAt == nil || r.EndsAt == nil {
+		return fmt.Errorf("startsAt and endsAt are required")
+	}
+	if err := domain.CheckWindow(domain.Window{Start: *r.StartsAt, End: *r.EndsAt}); err != nil {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+	if !r.EndsAt.After(now) {
+		return fmt.Errorf("The event is already over")
+	}
+	return checkCoordinates(r.Latitude, r.Longitude)
+}
+
+func (r ScheduleEventRequest) Apply(e *database.ScheduleEvent) {
+	e.Name = strings.TrimSpace(r.Name)
+	e.StartsAt = *r.StartsAt
+	e.EndsAt = *r.EndsAt
+	e.Latitude = *r.Latitude
+	e.Longitude = *r.Longitude
+	e.Address = strings.TrimSpace(r.Address)
+}
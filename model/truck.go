@@ -1,11 +1,443 @@
 package model
 
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+)
+
+const (
+	MaxCuisines 			= 10
+	MaxDescriptionLength 	= 2000
+)
+
+// Networks a truck can link to besides its website
+var SocialNetworks = map[string]bool{
+	"instagram": true,
+	"facebook": true,
+	"x": true,
+	"tiktok": true,
+	"yelp": true,
+}
+
+var (
+	zipPattern 		= regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)
+	statePattern 	= regexp.MustCompile(`^[A-Z]{2}$`)
+	phoneStripper 	= strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	phonePattern 	= regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+)
+
+// A truck as returned by the API
 type Truck struct {
-	ID		int		`json:"id"`
-	Name 	string 	`json:"name"`
-	// Cell	string	`json:"cell"`
-	// Address string 	`json:"address"`
-	// City	string 	`json:"city"`
-	// State	string	`json:"state"`
-	// Zip		string	`json:"zip"`
-}
\ No newline at end of file
+	ID				int					`json:"id"`
+	Name 			string 				`json:"name"`
+	OwnerID			int					`json:"ownerId"`
+	Cell			string				`json:"cell"`
+	Address 		string 				`json:"address"`
+	City			string 				`json:"city"`
+	State			string				`json:"state"`
+	Zip				string				`json:"zip"`
+	Description 	string 				`json:"description"`
+	Cuisines 		[]string 			`json:"cuisines"`
+	Website 		string 				`json:"website"`
+	SocialLinks 	map[string]string 	`json:"socialLinks"`
+	Timezone 		string 				`json:"timezone"`
+	Hours 			[]Hours 			`json:"hours"`
+	HoursExceptions []HoursException 	`json:"hoursExceptions"`
+	Rating 			float64 			`json:"rating"`
+	RatingCount 	int 				`json:"ratingCount"`
+	FavoriteCount 	int 				`json:"favoriteCount"`
+	Location 		*TruckLocation 		`json:"location"`
+	// Computed from the hours, exceptions and schedule when the truck is loaded
+	IsOpen 			bool 				`json:"isOpen"`
+	NextOpening 	*time.Time 			`json:"nextOpening"`
+}
+
+// Opening hours as "HH:MM" in the truck's timezone, e.g.
+// {"day":"fri","opens":"20:00","closes":"02:00"} for a late night shift
+type Hours struct {
+	Day 	string 	`json:"day"`
+	Opens 	string 	`json:"opens"`
+	Closes 	string 	`json:"closes"`
+}
+
+// A date whose hours differ from the weekly ones. Closed days have no hours
+type HoursException struct {
+	Date 	string 	`json:"date"`
+	Closed 	bool 	`json:"closed"`
+	Opens 	string 	`json:"opens,omitempty"`
+	Closes 	string 	`json:"closes,omitempty"`
+	Note 	string 	`json:"note,omitempty"`
+}
+
+// Where the truck last reported being. Stale means the report is older than
+// the configured threshold, so the truck may have moved or closed
+type TruckLocation struct {
+	Latitude 	float64 	`json:"lat"`
+	Longitude 	float64 	`json:"lng"`
+	Accuracy 	float64 	`json:"accuracy"`
+	RecordedAt 	time.Time 	`json:"recordedAt"`
+	Stale 		bool 		`json:"stale"`
+}
+
+// Body of PUT /truck/{id}/location. RecordedAt defaults to now
+type LocationRequest struct {
+	Latitude 	*float64 	`json:"lat"`
+	Longitude 	*float64 	`json:"lng"`
+	Accuracy 	float64 	`json:"accuracy"`
+	RecordedAt 	*time.Time 	`json:"recordedAt"`
+}
+
+// How far in the future a reported timestamp may be, to allow for clock skew
+const MaxLocationClockSkew = time.Minute
+
+// A truck in nearby search results
+type NearbyTruck struct {
+	Truck
+	DistanceMeters 	float64 	`json:"distanceMeters"`
+}
+
+// Body of POST /truck and PUT /truck/{id}. Fields left out are unchanged, so
+// an update can send just the fields it changes; a list that is sent replaces
+// the whole list. OwnerID is only honoured for admins
+type TruckRequest struct {
+	Name 			*string 			`json:"name"`
+	OwnerID			int					`json:"ownerId"`
+	Cell 			*string 			`json:"cell"`
+	Address 		*string 			`json:"address"`
+	City 			*string 			`json:"city"`
+	State 			*string 			`json:"state"`
+	Zip 			*string 			`json:"zip"`
+	Description 	*string 			`json:"description"`
+	Cuisines 		*[]string 			`json:"cuisines"`
+	Website 		*string 			`json:"website"`
+	SocialLinks 	*map[string]string 	`json:"socialLinks"`
+	Timezone 		*string 			`json:"timezone"`
+	Hours 			*[]Hours 			`json:"hours"`
+	HoursExceptions *[]HoursException 	`json:"hoursExceptions"`
+}
+
+func NewTruck(t database.Truck, staleAfter time.Duration) Truck {
+	cuisines := t.Cuisines
+	if cuisines == nil {
+		cuisines = []string{}
+	}
+	links := t.SocialLinks
+	if links == nil {
+		links = map[string]string{}
+	}
+	truck := Truck{
+		ID: t.ID,
+		Name: t.Name,
+		OwnerID: t.OwnerID,
+		Cell: t.Cell,
+		Address: t.Address,
+		City: t.City,
+		State: t.State,
+		Zip: t.Zip,
+		Description: t.Description,
+		Cuisines: cuisines,
+		Website: t.Website,
+		SocialLinks: links,
+		Timezone: t.Timezone,
+		Rating: t.Rating,
+		RatingCount: t.RatingCount,
+		FavoriteCount: t.FavoriteCount,
+		Hours: make([]Hours, 0, len(t.Hours)),
+		HoursExceptions: make([]HoursException, 0, len(t.HoursExceptions)),
+	}
+	for _, h := range t.Hours {
+		truck.Hours = append(truck.Hours, Hours{
+			Day: domain.WeekdayName(h.Day),
+			Opens: h.Opens.String(),
+			Closes: h.Closes.String(),
+		})
+	}
+	for _, e := range t.HoursExceptions {
+		ex := HoursException{Date: e.Date.Format(domain.DateLayout), Closed: e.Closed, Note: e.Note}
+		if !e.Closed {
+			ex.Opens = e.Opens.String()
+			ex.Closes = e.Closes.String()
+		}
+		truck.HoursExceptions = append(truck.HoursExceptions, ex)
+	}
+	if t.Location != nil {
+		loc := NewTruckLocation(*t.Location, staleAfter)
+		truck.Location = &loc
+	}
+	now := time.Now()
+	schedule := t.Schedule()
+	truck.IsOpen = schedule.IsOpen(now)
+	if next, ok := schedule.NextOpening(now); ok {
+		truck.NextOpening = &next
+	}
+	return truck
+}
+
+func NewTrucks(rows []database.Truck, staleAfter time.Duration) []Truck {
+	trucks := make([]Truck, 0, len(rows))
+	for _, t := range rows {
+		trucks = append(trucks, NewTruck(t, staleAfter))
+	}
+	return trucks
+}
+
+func NewNearbyTrucks(rows []database.TruckDistance, staleAfter time.Duration) []NearbyTruck {
+	trucks := make([]NearbyTruck, 0, len(rows))
+	for _, t := range rows {
+		trucks = append(trucks, NearbyTruck{
+			Truck: NewTruck(t.Truck, staleAfter),
+			DistanceMeters: math.Round(t.DistanceMeters),
+		})
+	}
+	return trucks
+}
+
+func NewTruckLocation(l database.Location, staleAfter time.Duration) TruckLocation {
+	return TruckLocation{
+		Latitude: l.Latitude,
+		Longitude: l.Longitude,
+		Accuracy: l.Accuracy,
+		RecordedAt: l.RecordedAt,
+		Stale: time.Since(l.RecordedAt) > staleAfter,
+	}
+}
+
+func NewTruckLocations(rows []database.Location, staleAfter time.Duration) []TruckLocation {
+	locations := make([]TruckLocation, 0, len(rows))
+	for _, l := range rows {
+		locations = append(locations, NewTruckLocation(l, staleAfter))
+	}
+	return locations
+}
+
+// Checks the fields a new truck must have
+func (r TruckRequest) Validate() error {
+	if r.Name == nil || strings.TrimSpace(*r.Name) == "" {
+		return fmt.Errorf("Truck name is required")
+	}
+	return nil
+}
+
+// Validates the fields the request sets and copies them onto a truck row,
+// normalizing phone numbers, states and cuisines
+func (r TruckRequest) Apply(t *database.Truck) error {
+	if r.Name != nil {
+		if strings.TrimSpace(*r.Name) == "" {
+			return fmt.Errorf("Truck name can't be empty")
+		}
+		t.Name = strings.TrimSpace(*r.Name)
+	}
+
+	if r.Cell != nil {
+		cell, err := normalizePhone(*r.Cell)
+		if err != nil {
+			return err
+		}
+		t.Cell = cell
+	}
+	if r.Address != nil {
+		t.Address = strings.TrimSpace(*r.Address)
+	}
+	if r.City != nil {
+		t.City = strings.TrimSpace(*r.City)
+	}
+	if r.State != nil {
+		state := strings.ToUpper(strings.TrimSpace(*r.State))
+		if state != "" && !statePattern.MatchString(state) {
+			return fmt.Errorf("State must be a two letter code")
+		}
+		t.State = state
+	}
+	if r.Zip != nil {
+		zip := strings.TrimSpace(*r.Zip)
+		if zip != "" && !zipPattern.MatchString(zip) {
+			return fmt.Errorf("Zip must be 5 digits or ZIP+4")
+		}
+		t.Zip = zip
+	}
+	if r.Description != nil {
+		if len(*r.Description) > MaxDescriptionLength {
+			return fmt.Errorf("Description can be at most %d characters", MaxDescriptionLength)
+		}
+		t.Description = strings.TrimSpace(*r.Description)
+	}
+
+	if r.Cuisines != nil {
+		cuisines, err := normalizeCuisines(*r.Cuisines)
+		if err != nil {
+			return err
+		}
+		t.Cuisines = cuisines
+	}
+	if r.Website != nil {
+		website := strings.TrimSpace(*r.Website)
+		if website != "" && !validURL(website) {
+			return fmt.Errorf("Website must be an http or https URL")
+		}
+		t.Website = website
+	}
+	if r.SocialLinks != nil {
+		links := map[string]string{}
+		for network, link := range *r.SocialLinks {
+			network = strings.ToLower(network)
+			if !SocialNetworks[network] {
+				return fmt.Errorf("Unknown social network '%s'", network)
+			}
+			if !validURL(link) {
+				return fmt.Errorf("The %s link must be an http or https URL", network)
+			}
+			links[network] = link
+		}
+		t.SocialLinks = links
+	}
+
+	if r.Timezone != nil {
+		if _, err := time.LoadLocation(*r.Timezone); err != nil || *r.Timezone == "" || *r.Timezone == "Local" {
+			return fmt.Errorf("Unknown timezone '%s'", *r.Timezone)
+		}
+		t.Timezone = *r.Timezone
+	}
+	if r.Hours != nil {
+		hours, err := parseHours(*r.Hours)
+		if err != nil {
+			return err
+		}
+		t.Hours = hours
+	}
+	if r.HoursExceptions != nil {
+		exceptions, err := parseHoursExceptions(*r.HoursExceptions)
+		if err != nil {
+			return err
+		}
+		t.HoursExceptions = exceptions
+	}
+
+	return nil
+}
+
+// Strips formatting from a phone number, keeping a leading +. Empty clears it
+func normalizePhone(s string) (string, error) {
+	phone := phoneStripper.Replace(strings.TrimSpace(s))
+	if phone != "" && !phonePattern.MatchString(phone) {
+		return "", fmt.Errorf("Cell must be a phone number of 10 to 15 digits")
+	}
+	return phone, nil
+}
+
+func normalizeCuisines(in []string) ([]string, error) {
+	if len(in) > MaxCuisines {
+		return nil, fmt.Errorf("A truck can list at most %d cuisines", MaxCuisines)
+	}
+	seen := map[string]bool{}
+	cuisines := []string{}
+	for _, c := range in {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			return nil, fmt.Errorf("Cuisines can't be empty")
+		}
+		if !seen[c] {
+			seen[c] = true
+			cuisines = append(cuisines, c)
+		}
+	}
+	return cuisines, nil
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func parseHours(in []Hours) ([]domain.Hours, error) {
+	hours := make([]domain.Hours, 0, len(in))
+	for _, h := range in {
+		day, err := domain.ParseWeekday(h.Day)
+		if err != nil {
+			return nil, err
+		}
+		opens, err := domain.ParseClock(h.Opens)
+		if err != nil {
+			return nil, err
+		}
+		closes, err := domain.ParseClock(h.Closes)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, domain.Hours{Day: day, Opens: opens, Closes: closes})
+	}
+	if err := domain.CheckHours(hours); err != nil {
+		return nil, fmt.Errorf("Invalid hours: %v", err)
+	}
+	return hours, nil
+}
+
+func parseHoursExceptions(in []HoursException) ([]domain.HoursException, error) {
+	exceptions := make([]domain.HoursException, 0, len(in))
+	for _, e := range in {
+		date, err := domain.ParseDate(e.Date)
+		if err != nil {
+			return nil, err
+		}
+		ex := domain.HoursException{Date: date, Closed: e.Closed, Note: strings.TrimSpace(e.Note)}
+		if !e.Closed {
+			if ex.Opens, err = domain.ParseClock(e.Opens); err != nil {
+				return nil, err
+			}
+			if ex.Closes, err = domain.ParseClock(e.Closes); err != nil {
+				return nil, err
+			}
+		}
+		exceptions = append(exceptions, ex)
+	}
+	if err := domain.CheckHoursExceptions(exceptions); err != nil {
+		return nil, fmt.Errorf("Invalid hours exceptions: %v", err)
+	}
+	return exceptions, nil
+}
+
+func (r LocationRequest) Validate(now time.Time) error {
+	if err := checkCoordinates(r.Latitude, r.Longitude); err != nil {
+		return err
+	}
+	if r.Accuracy < 0 {
+		return fmt.Errorf("Accuracy can't be negative")
+	}
+	if r.RecordedAt != nil && r.RecordedAt.After(now.Add(MaxLocationClockSkew)) {
+		return fmt.Errorf("recordedAt can't be in the future")
+	}
+	return nil
+}
+
+// Builds the location row, stamping it with now if the client didn't
+func checkCoordinates(lat, lng *float64) error {
+	if lat == nil || lng == nil {
+		return fmt.Errorf("lat and lng are required")
+	}
+	if *lat < -90 || *lat > 90 {
+		return fmt.Errorf("lat must be between -90 and 90")
+	}
+	if *lng < -180 || *lng > 180 {
+		return fmt.Errorf("lng must be between -180 and 180")
+	}
+	return nil
+}
+
+func (r LocationRequest) ToLocation(now time.Time) database.Location {
+	recordedAt := now
+	if r.RecordedAt != nil {
+		recordedAt = *r.RecordedAt
+	}
+	return database.Location{
+		Latitude: *r.Latitude,
+		Longitude: *r.Longitude,
+		Accuracy: r.Accuracy,
+		RecordedAt: recordedAt,
+	}
+}
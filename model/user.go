@@ -1,9 +1,167 @@
 package model
 
+import (
+	"fmt"
+
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+)
+
+const MinPasswordLength = 8
+
+// A user as returned by the API. Never carries the password hash
 type User struct {
+	ID 			int 	`json:"id"`
+	Username 	string 	`json:"username"`
+	Fname		string	`json:"fname"`
+	Lname		string	`json:"lname"`
+	Email		string	`json:"email"`
+	Cell		string	`json:"cell"`
+	HasTruck	bool	`json:"hasTruck"`
+	Role		string	`json:"role"`
+}
+
+// Body of POST /auth/authenticate
+type Credentials struct {
 	Username 	string 	`json:"username"`
+	Password	string	`json:"password"`
+}
+
+// Body of POST /auth/register
+type RegisterRequest struct {
+	Username 	string 	`json:"username"`
+	Password	string	`json:"password"`
 	Fname		string	`json:"fname"`
 	Lname		string	`json:"lname"`
 	Email		string	`json:"email"`
 	Cell		string	`json:"cell"`
-}
\ No newline at end of file
+}
+
+// Body of POST /user, for admins creating accounts on someone's behalf
+type CreateUserRequest struct {
+	Username 	string 	`json:"username"`
+	Password	string	`json:"password"`
+	Fname		string	`json:"fname"`
+	Lname		string	`json:"lname"`
+	Email		string	`json:"email"`
+	Cell		string	`json:"cell"`
+	HasTruck	bool	`json:"hasTruck"`
+	Role		string	`json:"role"`
+}
+
+// Body of PUT /user/{id}. Passwords are changed through PUT /user/{id}/password,
+// and hasTruck is only set by creating a truck
+type UpdateUserRequest struct {
+	Username 	string 	`json:"username"`
+	Fname		string	`json:"fname"`
+	Lname		string	`json:"lname"`
+	Email		string	`json:"email"`
+	Cell		string	`json:"cell"`
+	Role		string	`json:"role"`
+}
+
+// Body of PUT /user/{id}/password
+type PasswordChangeRequest struct {
+	CurrentPassword 	string 	`json:"currentPassword"`
+	NewPassword 		string 	`json:"newPassword"`
+}
+
+func NewUser(u database.User) User {
+	return User{
+		ID: u.ID,
+		Username: u.Username,
+		Fname: u.Fname,
+		Lname: u.Lname,
+		Email: u.Email,
+		Cell: u.Cell,
+		HasTruck: u.HasTruck,
+		Role: u.Role,
+	}
+}
+
+func NewUsers(rows []database.User) []User {
+	users := make([]User, 0, len(rows))
+	for _, u := range rows {
+		users = append(users, NewUser(u))
+	}
+	return users
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("Password must be at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+func (r RegisterRequest) Validate() error {
+	if r.Username == "" || r.Email == "" {
+		return fmt.Errorf("Username, password and email are required")
+	}
+	return ValidatePassword(r.Password)
+}
+
+// Builds the row for a newly registered user with the given password hash.
+// Everyone signs up as a customer and becomes a truck owner once a truck is
+// created for them
+func (r RegisterRequest) ToRow(hash string) database.User {
+	return database.User{
+		Username: r.Username,
+		Hash: hash,
+		Fname: r.Fname,
+		Lname: r.Lname,
+		Email: r.Email,
+		Cell: r.Cell,
+		Role: database.RoleCustomer,
+	}
+}
+
+func (r CreateUserRequest) Validate() error {
+	if r.Username == "" || r.Email == "" {
+		return fmt.Errorf("Username, password and email are required")
+	}
+	if r.Role != "" && !database.ValidRole(r.Role) {
+		return fmt.Errorf("Invalid role")
+	}
+	return ValidatePassword(r.Password)
+}
+
+// Builds the row for a new user with the given password hash
+func (r CreateUserRequest) ToRow(hash string) database.User {
+	role := r.Role
+	if role == "" {
+		role = database.RoleCustomer
+	}
+
+	return database.User{
+		Username: r.Username,
+		Hash: hash,
+		Fname: r.Fname,
+		Lname: r.Lname,
+		Email: r.Email,
+		Cell: r.Cell,
+		HasTruck: r.HasTruck,
+		Role: role,
+	}
+}
+
+// Copies the updatable fields onto an existing row. The role is only applied
+// when allowRoleChange is set, i.e. for admins
+func (r UpdateUserRequest) Apply(u *database.User, allowRoleChange bool) error {
+	if r.Username == "" || r.Email == "" {
+		return fmt.Errorf("Username and email are required")
+	}
+
+	u.Username = r.Username
+	u.Fname = r.Fname
+	u.Lname = r.Lname
+	u.Email = r.Email
+	u.Cell = r.Cell
+
+	if allowRoleChange && r.Role != "" {
+		if !database.ValidRole(r.Role) {
+			return fmt.Errorf("Invalid role")
+		}
+		u.Role = r.Role
+	}
+	return nil
+}
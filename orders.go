@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/auth"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+func (a *App) GetOrdersForUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+		return
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	orders, page, err := a.Store.GetOrdersForUser(r.Context(), id, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewOrders(orders), page)
+}
+
+func (a *App) GetOrdersForTruck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	orders, page, err := a.Store.GetOrdersForTruck(r.Context(), id, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewOrders(orders), page)
+}
+
+// Places an order for the caller. Line prices, including any chosen options,
+// are snapshotted from the menu and the total is computed here, never taken
+// from the client
+func (a *App) CreateOrderForTruck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return
+	}
+
+	var req model.OrderRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	t := database.Truck{ID: truckID}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	o := database.Order{UserID: auth.UserID(r.Context()), TruckID: truckID, Notes: req.Notes}
+	for _, item := range req.Items {
+		m := database.MenuItem{ID: item.MenuItemID}
+		if err := a.Store.GetMenuItem(r.Context(), &m); err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				respondWithError(w, http.StatusBadRequest, constants.ERROR, "Menu item " + strconv.Itoa(item.MenuItemID) + " not found")
+			} else {
+				renderError(w, r, err)
+			}
+			return
+		}
+		if m.TruckID != truckID {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Menu item " + strconv.Itoa(m.ID) + " is not sold by this truck")
+			return
+		}
+		if !m.Available {
+			respondWithError(w, http.StatusConflict, constants.ERROR, "Menu item " + strconv.Itoa(m.ID) + " is not available")
+			return
+		}
+
+		groups, err := a.Store.GetOptionGroups(r.Context(), []int{m.ID})
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		rules := make([]domain.OptionGroup, 0, len(groups[m.ID]))
+		for _, g := range groups[m.ID] {
+			rules = append(rules, g.Rules())
+		}
+		selections, err := domain.SelectOptions(rules, item.Options)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, domain.ErrOptionUnavailable) {
+				code = http.StatusConflict
+			}
+			respondWithError(w, code, constants.ERROR, "Invalid options for " + m.Name + ": " + err.Error())
+			return
+		}
+
+		line := model.NewOrderLine(m, item.Quantity, selections)
+		o.Items = append(o.Items, line)
+		o.TotalCents += line.LineTotalCents
+	}
+
+	if err := a.Store.CreateOrder(r.Context(), &o); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewOrder(o))
+}
+
+// Moves an order to a new status. The truck can walk it through its
+// lifecycle; the customer who placed it can only cancel it before acceptance
+func (a *App) UpdateOrderForTruck(w http.ResponseWriter, r *http.Request) {
+	o, ok := a.orderForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	actor, ok := a.orderActor(w, r, o)
+	if !ok {
+		return
+	}
+
+	var req model.OrderStatusRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := domain.CheckTransition(o.Status, req.Status, actor); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnknownStatus):
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid order status")
+		case errors.Is(err, domain.ErrTransitionForbidden):
+			respondWithError(w, http.StatusForbidden, constants.ERROR, "You may not move this order from " + o.Status + " to " + req.Status)
+		default:
+			respondWithError(w, http.StatusConflict, constants.ERROR, "An order can't move from " + o.Status + " to " + req.Status)
+		}
+		return
+	}
+
+	moved, err := a.Store.TransitionOrderStatus(r.Context(), &o, req.Status, auth.UserID(r.Context()), req.Reason)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !moved {
+		respondWithError(w, http.StatusConflict, constants.ERROR, "The order was updated by someone else, reload and try again")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewOrder(o))
+}
+
+func (a *App) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	o, ok := a.orderForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := a.orderActor(w, r, o); !ok {
+		return
+	}
+
+	history, err := a.Store.GetOrderHistory(r.Context(), o.ID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewOrderHistory(history))
+}
+
+func (a *App) DeleteOrderForTruck(w http.ResponseWriter, r *http.Request) {
+	o, ok := a.orderForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteOrder(r.Context(), &o); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted order with id " + strconv.Itoa(o.ID), "")
+}
+
+// Loads the order named by the {orderId} route variable, responding with a
+// 404 unless it belongs to the truck named by {id}
+func (a *App) orderForTruck(w http.ResponseWriter, r *http.Request) (database.Order, bool) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.Order{}, false
+	}
+	orderID, err := strconv.Atoi(vars["orderId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid order ID")
+		return database.Order{}, false
+	}
+
+	o := database.Order{ID: orderID}
+	if err := a.Store.GetOrder(r.Context(), &o); err != nil {
+		renderError(w, r, err)
+		return database.Order{}, false
+	}
+	if o.TruckID != truckID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Order not found")
+		return database.Order{}, false
+	}
+
+	return o, true
+}
+
+// Works out whether the caller acts for the truck or as the order's customer,
+// responding with a 403 if neither
+func (a *App) orderActor(w http.ResponseWriter, r *http.Request, o database.Order) (domain.Actor, bool) {
+	caller, _ := auth.UserFrom(r.Context())
+	if caller.IsAdmin() {
+		return domain.ActorTruck, true
+	}
+
+	t := database.Truck{ID: o.TruckID}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return 0, false
+	}
+	if t.OwnerID == caller.ID {
+		return domain.ActorTruck, true
+	}
+	if o.UserID == caller.ID {
+		return domain.ActorCustomer, true
+	}
+
+	respondWithError(w, http.StatusForbidden, constants.ERROR, "Only the truck's owner or the customer may do that")
+	return 0, false
+}
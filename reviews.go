@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/auth"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+// Returns a page of the truck's reviews, newest first
+func (a *App) GetTruckReviews(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	reviews, page, err := a.Store.GetReviews(r.Context(), t.ID, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewReviews(reviews), page)
+}
+
+// Creates the caller's review of the truck, or replaces their earlier one.
+// Responds with a 201 for a new review and a 200 for an edit
+func (a *App) SaveTruckReview(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+
+	caller, _ := auth.UserFrom(r.Context())
+	if t.OwnerID == caller.ID {
+		respondWithError(w, http.StatusForbidden, constants.ERROR, "Owners can't review their own truck")
+		return
+	}
+
+	var req model.ReviewRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	// Only an order the caller picked up from this truck verifies the review
+	if req.OrderID != 0 {
+		o := database.Order{ID: req.OrderID}
+		if err := a.Store.GetOrder(r.Context(), &o); err != nil && !errors.Is(err, database.ErrNotFound) {
+			renderError(w, r, err)
+			return
+		}
+		if o.UserID != caller.ID || o.TruckID != t.ID || o.Status != domain.StatusPickedUp {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "The order must be one of your completed orders from this truck")
+			return
+		}
+	}
+
+	review := database.Review{TruckID: t.ID, UserID: caller.ID}
+	req.Apply(&review)
+	created, err := a.Store.SaveReview(r.Context(), &review)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	// Reload for the author's name and any reply the review already had
+	if err := a.Store.GetReview(r.Context(), &review); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	respondWithJSON(w, code, constants.SUCCESS, constants.NA, model.NewReview(review))
+}
+
+// Deletes a review. Only its author or an admin may
+func (a *App) DeleteTruckReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.reviewForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	caller, _ := auth.UserFrom(r.Context())
+	if review.UserID != caller.ID && !caller.IsAdmin() {
+		respondWithError(w, http.StatusForbidden, constants.ERROR, "Only the review's author may delete it")
+		return
+	}
+
+	if err := a.Store.DeleteReview(r.Context(), &review); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted review with id " + strconv.Itoa(review.ID), "")
+}
+
+// Sets the truck owner's public reply to a review
+func (a *App) ReplyToTruckReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.reviewForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ReviewReplyRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	if err := a.Store.SetReviewReply(r.Context(), &review, req.Reply); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	review.Reply = req.Reply
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewReview(review))
+}
+
+// Loads the review named by the route, responding with a 404 if it belongs
+// to another truck
+func (a *App) reviewForTruck(w http.ResponseWriter, r *http.Request) (database.Review, bool) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.Review{}, false
+	}
+	reviewID, err := strconv.Atoi(vars["reviewId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid review ID")
+		return database.Review{}, false
+	}
+
+	review := database.Review{ID: reviewID}
+	if err := a.Store.GetReview(r.Context(), &review); err != nil {
+		renderError(w, r, err)
+		return database.Review{}, false
+	}
+	if review.TruckID != truckID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Review not found")
+		return database.Review{}, false
+	}
+
+	return review, true
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
+	"github.com/Nagoogin/munch-bunch-rest-api/domain"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
+)
+
+// Returns the truck's weekly slots and the events that haven't ended yet
+func (a *App) GetTruckSchedule(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewSchedule(t))
+}
+
+func (a *App) CreateScheduleSlot(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ScheduleSlotRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	s := database.ScheduleSlot{TruckID: t.ID}
+	if err := req.Apply(&s); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	if err := checkScheduleSlots(append(t.ScheduleSlots, s)); err != nil {
+		respondWithError(w, http.StatusConflict, constants.ERROR, err.Error())
+		return
+	}
+
+	if err := a.Store.CreateScheduleSlot(r.Context(), &s); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewScheduleSlot(s))
+}
+
+func (a *App) UpdateScheduleSlot(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+	s, ok := scheduleSlotForTruck(w, r, t)
+	if !ok {
+		return
+	}
+
+	var req model.ScheduleSlotRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Apply(&s); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	slots := []database.ScheduleSlot{s}
+	for _, other := range t.ScheduleSlots {
+		if other.ID != s.ID {
+			slots = append(slots, other)
+		}
+	}
+	if err := checkScheduleSlots(slots); err != nil {
+		respondWithError(w, http.StatusConflict, constants.ERROR, err.Error())
+		return
+	}
+
+	if err := a.Store.UpdateScheduleSlot(r.Context(), &s); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewScheduleSlot(s))
+}
+
+func (a *App) DeleteScheduleSlot(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+	s, ok := scheduleSlotForTruck(w, r, t)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteScheduleSlot(r.Context(), &s); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted slot with id " + strconv.Itoa(s.ID), "")
+}
+
+func (a *App) CreateScheduleEvent(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.truckForRoute(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ScheduleEventRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(time.Now()); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	e := database.ScheduleEvent{TruckID: t.ID}
+	req.Apply(&e)
+	if err := a.Store.CreateScheduleEvent(r.Context(), &e); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewScheduleEvent(e))
+}
+
+func (a *App) UpdateScheduleEvent(w http.ResponseWriter, r *http.Request) {
+	e, ok := a.scheduleEventForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ScheduleEventRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(time.Now()); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	req.Apply(&e)
+	if err := a.Store.UpdateScheduleEvent(r.Context(), &e); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewScheduleEvent(e))
+}
+
+func (a *App) DeleteScheduleEvent(w http.ResponseWriter, r *http.Request) {
+	e, ok := a.scheduleEventForTruck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Store.DeleteScheduleEvent(r.Context(), &e); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted event with id " + strconv.Itoa(e.ID), "")
+}
+
+// Weekly slots can't overlap, the truck can only be in one place at a time
+func checkScheduleSlots(slots []database.ScheduleSlot) error {
+	hours := make([]domain.Hours, 0, len(slots))
+	for _, s := range slots {
+		hours = append(hours, s.Hours())
+	}
+	if err := domain.CheckHours(hours); err != nil {
+		return fmt.Errorf("The slot overlaps another slot: %v", err)
+	}
+	return nil
+}
+
+// Loads the truck named by the route along with its hours and schedule
+func (a *App) truckForRoute(w http.ResponseWriter, r *http.Request) (database.Truck, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.Truck{}, false
+	}
+
+	t := database.Truck{ID: id}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return database.Truck{}, false
+	}
+
+	return t, true
+}
+
+// Picks the slot named by the route out of the truck's schedule
+func scheduleSlotForTruck(w http.ResponseWriter, r *http.Request, t database.Truck) (database.ScheduleSlot, bool) {
+	slotID, err := strconv.Atoi(mux.Vars(r)["slotId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid slot ID")
+		return database.ScheduleSlot{}, false
+	}
+
+	for _, s := range t.ScheduleSlots {
+		if s.ID == slotID {
+			return s, true
+		}
+	}
+
+	respondWithError(w, http.StatusNotFound, constants.ERROR, "Slot not found")
+	return database.ScheduleSlot{}, false
+}
+
+// Loads the event named by the route, responding with a 404 if it belongs to
+// another truck. Events that are over can still be deleted
+func (a *App) scheduleEventForTruck(w http.ResponseWriter, r *http.Request) (database.ScheduleEvent, bool) {
+	vars := mux.Vars(r)
+	truckID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid truck ID")
+		return database.ScheduleEvent{}, false
+	}
+	eventID, err := strconv.Atoi(vars["eventId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid event ID")
+		return database.ScheduleEvent{}, false
+	}
+
+	e := database.ScheduleEvent{ID: eventID}
+	if err := a.Store.GetScheduleEvent(r.Context(), &e); err != nil {
+		renderError(w, r, err)
+		return database.ScheduleEvent{}, false
+	}
+	if e.TruckID != truckID {
+		respondWithError(w, http.StatusNotFound, constants.ERROR, "Event not found")
+		return database.ScheduleEvent{}, false
+	}
+
+	return e, true
+}
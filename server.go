@@ -1,24 +1,29 @@
 package main 
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"flag"
 	"net/http"
-	"database/sql"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"github.com/dimiro1/health"
-	"github.com/dimiro1/health/db"
 	"github.com/dimiro1/health/url"
+	"github.com/Nagoogin/munch-bunch-rest-api/auth"
 	"github.com/Nagoogin/munch-bunch-rest-api/database"
 	"github.com/Nagoogin/munch-bunch-rest-api/handler"
 	"github.com/Nagoogin/munch-bunch-rest-api/crypto"
 	"github.com/Nagoogin/munch-bunch-rest-api/constants"
+	"github.com/Nagoogin/munch-bunch-rest-api/config"
+	"github.com/Nagoogin/munch-bunch-rest-api/model"
 
 	_ "github.com/lib/pq"
 )
@@ -26,34 +31,40 @@ import (
 type App struct {
 	Router 		*mux.Router
 	Subrouter 	*mux.Router
-	DB 			*sql.DB
+	// Everything the handlers read and write goes through the store
+	Store 		database.Store
+	Config 		*config.Config
+	Keys 		*auth.Keyring
 }
 
 type JwtToken struct {
-	Token string `json:"token"`
+	Token 			string 	`json:"token"`
+	ExpiresAt 		int64 	`json:"expiresAt"`
+	RefreshToken 	string 	`json:"refreshToken"`
 }
 
-func (a *App) CheckTablesExist() {
-    if _, err := a.DB.Exec(constants.USER_TABLE_CREATION_QUERY); err != nil {
-        log.Fatal(err)
-    }
-    if _, err2 := a.DB.Exec(constants.TRUCK_TABLE_CREATION_QUERY); err2 != nil {
-    	log.Fatal(err2)
-    }
+type RefreshRequest struct {
+	RefreshToken 	string 	`json:"refreshToken"`
 }
 
-func (a *App) Initialize(user, password, dbname string) {
+type RegisterRsp struct {
+	User 	model.User 	`json:"user"`
+	JwtToken
+}
+
+func (a *App) Initialize(cfg *config.Config, store database.Store) {
 	fmt.Println("In Initialize()")
-	psqlInfo := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable",
-    user, password, dbname)
+	a.Config = cfg
+	a.Store = store
 
 	var err error
-    a.DB, err = sql.Open("postgres", psqlInfo)  
-	if err != nil {  
-	  log.Fatal(err)
+	a.Keys, err = auth.LoadKeyring(cfg.Auth)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	a.Router = mux.NewRouter();
+	a.Router.Use(a.TimeoutMiddleware)
 	a.Subrouter = a.Router.PathPrefix("/api/v1").Subrouter()
 	a.InitializeRoutes()
 	fmt.Println("Done with Initialize()")
@@ -64,76 +75,318 @@ func (a *App) InitializeRoutes() {
 
 	// Auth endpoints
 	a.Subrouter.Methods("POST").Path("/auth/register").HandlerFunc(a.Register)
-	a.Subrouter.Methods("POST").Path("/auth/logout").HandlerFunc(a.Logout)
+	a.Subrouter.Methods("POST").Path("/auth/logout").HandlerFunc(a.ValidateMiddleware(a.Logout))
+	a.Subrouter.Methods("POST").Path("/auth/logout-all").HandlerFunc(a.ValidateMiddleware(a.LogoutAll))
 	a.Subrouter.Methods("POST").Path("/auth/authenticate").HandlerFunc(a.CreateToken)
+	a.Subrouter.Methods("POST").Path("/auth/refresh").HandlerFunc(a.RefreshToken)
+	a.Subrouter.Methods("GET").Path("/.well-known/jwks.json").HandlerFunc(a.GetJWKS)
 
 	// User endpoints
-	a.Subrouter.Methods("GET").Path("/user/{id:[0-9]+}").HandlerFunc(a.GetUser)
-	a.Subrouter.Methods("POST").Path("/user").HandlerFunc(a.CreateUser)
-	a.Subrouter.Methods("PUT").Path("/user/{id:[0-9]+}").HandlerFunc(a.UpdateUser)
-	a.Subrouter.Methods("DELETE").Path("/user/{id:[0-9]+}").HandlerFunc(a.DeleteUser)
+	a.Subrouter.Methods("GET").Path("/users").HandlerFunc(a.ValidateMiddleware(a.RequireRole(database.RoleAdmin)(a.GetUsers)))
+	a.Subrouter.Methods("GET").Path("/user/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.GetUser)))
+	a.Subrouter.Methods("POST").Path("/user").HandlerFunc(a.ValidateMiddleware(a.RequireRole(database.RoleAdmin)(a.CreateUser)))
+	a.Subrouter.Methods("PUT").Path("/user/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.UpdateUser)))
+	a.Subrouter.Methods("PUT").Path("/user/{id:[0-9]+}/password").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.ChangePassword)))
+	a.Subrouter.Methods("DELETE").Path("/user/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.DeleteUser)))
+	a.Subrouter.Methods("POST").Path("/user/{id:[0-9]+}/logout-all").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.LogoutUser)))
 
-	a.Subrouter.Methods("GET").Path("/user{id:[0-9]+}/orders").HandlerFunc(a.GetOrdersForUser)
+	a.Subrouter.Methods("GET").Path("/user/{id:[0-9]+}/orders").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.GetOrdersForUser)))
 
-	// Truck endpoints
-	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}").HandlerFunc(ValidateMiddleware(a.GetTruck))
-	a.Subrouter.Methods("GET").Path("/trucks").HandlerFunc(ValidateMiddleware(a.GetTrucks))
-	a.Subrouter.Methods("POST").Path("/truck").HandlerFunc(ValidateMiddleware(a.CreateTruck))
-	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}").HandlerFunc(ValidateMiddleware(a.UpdateTruck))
-	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}").HandlerFunc(ValidateMiddleware(a.DeleteTruck))
+	a.Subrouter.Methods("GET").Path("/user/{id:[0-9]+}/favorites").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.GetFavorites)))
+	a.Subrouter.Methods("POST").Path("/user/{id:[0-9]+}/favorites/{truckId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.AddFavorite)))
+	a.Subrouter.Methods("DELETE").Path("/user/{id:[0-9]+}/favorites/{truckId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireSelfOrAdmin(a.RemoveFavorite)))
 
-	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/orders").HandlerFunc(a.GetOrdersForTruck)
-	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/orders").HandlerFunc(a.CreateOrderForTruck)
-	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/order{id:[0-9]+}").HandlerFunc(a.UpdateOrderForTruck)
-	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/order/{id:[0-9]+}").HandlerFunc(a.DeleteOrderForTruck)
+	// Truck endpoints
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.GetTruck))
+	a.Subrouter.Methods("GET").Path("/trucks").HandlerFunc(a.ValidateMiddleware(a.GetTrucks))
+	a.Subrouter.Methods("GET").Path("/trucks/nearby").HandlerFunc(a.ValidateMiddleware(a.GetTrucksNearby))
+	a.Subrouter.Methods("POST").Path("/truck").HandlerFunc(a.ValidateMiddleware(a.RequireRole(database.RoleTruckOwner, database.RoleAdmin)(a.CreateTruck)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateTruck)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteTruck)))
+
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/location").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateTruckLocation)))
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/locations").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.GetTruckLocations)))
+
+	// Schedule endpoints
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/schedule").HandlerFunc(a.ValidateMiddleware(a.GetTruckSchedule))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/schedule/slots").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.CreateScheduleSlot)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/schedule/slot/{slotId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateScheduleSlot)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/schedule/slot/{slotId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteScheduleSlot)))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/schedule/events").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.CreateScheduleEvent)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/schedule/event/{eventId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateScheduleEvent)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/schedule/event/{eventId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteScheduleEvent)))
+
+	// Review endpoints
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/reviews").HandlerFunc(a.ValidateMiddleware(a.GetTruckReviews))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/review").HandlerFunc(a.ValidateMiddleware(a.SaveTruckReview))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/review/{reviewId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.DeleteTruckReview))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/review/{reviewId:[0-9]+}/reply").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.ReplyToTruckReview)))
+
+	// Menu endpoints
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/menu").HandlerFunc(a.GetMenu)
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/menu").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateMenu)))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/menu/categories").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.CreateMenuCategory)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/menu/category/{categoryId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateMenuCategory)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/menu/category/{categoryId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteMenuCategory)))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/menu/items").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.CreateMenuItem)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateMenuItem)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}/availability").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.SetMenuItemAvailability)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteMenuItem)))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}/option-groups").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.CreateOptionGroup)))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}/option-group/{groupId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.UpdateOptionGroup)))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/menu/item/{itemId:[0-9]+}/option-group/{groupId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteOptionGroup)))
+
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/orders").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.GetOrdersForTruck)))
+	a.Subrouter.Methods("POST").Path("/truck/{id:[0-9]+}/orders").HandlerFunc(a.ValidateMiddleware(a.CreateOrderForTruck))
+	a.Subrouter.Methods("PUT").Path("/truck/{id:[0-9]+}/order/{orderId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.UpdateOrderForTruck))
+	a.Subrouter.Methods("GET").Path("/truck/{id:[0-9]+}/order/{orderId:[0-9]+}/history").HandlerFunc(a.ValidateMiddleware(a.GetOrderHistory))
+	a.Subrouter.Methods("DELETE").Path("/truck/{id:[0-9]+}/order/{orderId:[0-9]+}").HandlerFunc(a.ValidateMiddleware(a.RequireTruckOwner(a.DeleteOrderForTruck)))
 
 
-	psqlChecker := db.NewPostgreSQLChecker(a.DB)
 	healthHandler := health.NewHandler()
-	healthHandler.AddChecker("api", url.NewChecker("http://localhost:8080/api/v1"))
-	healthHandler.AddChecker("db", psqlChecker)
+	healthHandler.AddChecker("api", url.NewChecker(a.statusURL()))
+	healthHandler.AddChecker("db", storeChecker{a.Store, a.Config.Database.QueryTimeout})
 	a.Subrouter.Path("/health").Handler(healthHandler)
 }
 
+// Returns the URL of the status endpoint as served on the configured address
+func (a *App) statusURL() string {
+	host := a.Config.Server.Addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	return "http://" + host + "/api/v1"
+}
+
+// Reports the store as down while it can't be reached within timeout
+type storeChecker struct {
+	store 		database.Store
+	timeout 	time.Duration
+}
+
+func (c storeChecker) Check() health.Health {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	h := health.NewHealth()
+	if err := c.store.Ping(ctx); err != nil {
+		h.Down()
+		h.AddInfo("error", err.Error())
+		return h
+	}
+	h.Up()
+	return h
+}
+
 func (a *App) Run(addr string) {
 	log.Fatal(http.ListenAndServe(addr, a.Router))
 }
 
 func respondWithError(w http.ResponseWriter, code int, status string, message string) {
-	respondWithJSON(w, code, status, message, "")
+	writeResponse(w, database.JsonRsp{Code: code, Status: status, ErrorCode: errorCodes[code], Message: message, Data: ""})
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, status string, message string, data interface{}) {
-	responseObject := database.JsonRsp{Code: code, Status: status, Message: message, Data: data}
+	writeResponse(w, database.JsonRsp{Code: code, Status: status, Message: message, Data: data})
+}
+
+// Responds with one page of a listing and the cursors around it
+func respondWithPage(w http.ResponseWriter, data interface{}, page database.Page) {
+	writeResponse(w, database.JsonRsp{Code: http.StatusOK, Status: constants.SUCCESS, Message: constants.NA, Data: data, Paging: &page})
+}
+
+// The error codes of responses handlers word themselves, by status
+var errorCodes = map[int]string{
+	http.StatusBadRequest: 			"invalid_request",
+	http.StatusUnauthorized: 		"unauthorized",
+	http.StatusForbidden: 			"forbidden",
+	http.StatusNotFound: 			"not_found",
+	http.StatusConflict: 			"conflict",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusServiceUnavailable: 	"request_cancelled",
+	http.StatusGatewayTimeout: 		"timeout",
+}
+
+// The status each kind of store error is answered with
+var errorStatuses = map[database.ErrorKind]int{
+	database.NotFound: 		http.StatusNotFound,
+	database.Conflict: 		http.StatusConflict,
+	database.Validation: 	http.StatusBadRequest,
+	database.Unauthorized: 	http.StatusUnauthorized,
+	database.Forbidden: 	http.StatusForbidden,
+}
+
+// Responds to an error the handler has no more specific answer for. A
+// database.Error is answered with its kind's status, its code and message; a
+// request that ran past its deadline with a 504 and one whose client went
+// away with a 503. Anything else is logged and answered with a 500 that
+// doesn't give away what went wrong
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *database.Error
+	switch {
+	case errors.As(err, &e):
+		writeResponse(w, database.JsonRsp{Code: errorStatuses[e.Kind], Status: constants.ERROR, ErrorCode: e.Code, Message: e.Message, Data: ""})
+	case errors.Is(err, context.DeadlineExceeded) || r.Context().Err() == context.DeadlineExceeded:
+		respondWithError(w, http.StatusGatewayTimeout, constants.ERROR, "Request timed out")
+	case errors.Is(err, context.Canceled) || r.Context().Err() == context.Canceled:
+		respondWithError(w, http.StatusServiceUnavailable, constants.ERROR, "Request was cancelled")
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		respondWithError(w, http.StatusInternalServerError, constants.ERROR, "Internal server error")
+	}
+}
+
+func writeResponse(w http.ResponseWriter, responseObject database.JsonRsp) {
 	response, _ := json.Marshal(responseObject)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
+	w.WriteHeader(responseObject.Code)
 	w.Write(response)
 }
 
+// Creates a new user account and returns it along with a JWT token for the new user
 func (a *App) Register(w http.ResponseWriter, r *http.Request) {
-	// TODO
-
-	var u database.User
+	var reg model.RegisterRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&u); err != nil {
+	if err := decoder.Decode(&reg); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
 
+	if err := reg.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	if !a.checkUserUnique(w, r, reg.Username, reg.Email, 0) {
+		return
+	}
+
+	u := reg.ToRow(crypto.HashAndSalt([]byte(reg.Password)))
+	if err := a.Store.CreateUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), u, "")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, RegisterRsp{User: model.NewUser(u), JwtToken: tokens})
 }
 
+// Responds with a conflict and returns false if the username or email
+// already belongs to a user other than excludeID
+func (a *App) checkUserUnique(w http.ResponseWriter, r *http.Request, username, email string, excludeID int) bool {
+	exists, err := a.Store.UsernameExists(r.Context(), username, excludeID)
+	if err != nil {
+		renderError(w, r, err)
+		return false
+	}
+	if exists {
+		respondWithError(w, http.StatusConflict, constants.ERROR, "Username is already taken")
+		return false
+	}
+
+	exists, err = a.Store.EmailExists(r.Context(), email, excludeID)
+	if err != nil {
+		renderError(w, r, err)
+		return false
+	}
+	if exists {
+		respondWithError(w, http.StatusConflict, constants.ERROR, "Email is already registered")
+		return false
+	}
+	return true
+}
+
+// Invalidates the JWT token presented in the Authorization header, along with
+// the refresh token family of the optional refresh token in the request body
 func (a *App) Logout(w http.ResponseWriter, r *http.Request) {
-	// TODO
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	var refresh RefreshRequest
+	if r.ContentLength > 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&refresh); err != nil {
+			respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	if err := a.Store.RevokeToken(r.Context(), principal.TokenID, principal.User.ID); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if refresh.RefreshToken != "" {
+		rt := database.RefreshToken{TokenHash: crypto.HashToken(refresh.RefreshToken)}
+		if err := a.Store.GetRefreshTokenByHash(r.Context(), &rt); err == nil && rt.UserID == principal.User.ID {
+			if err := a.Store.RevokeRefreshTokenFamily(r.Context(), rt.Family); err != nil {
+				renderError(w, r, err)
+				return
+			}
+		} else if err != nil && !errors.Is(err, database.ErrNotFound) {
+			renderError(w, r, err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully logged out", "")
+}
+
+// Invalidates every JWT token issued so far to the user presenting the token
+func (a *App) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.UserFrom(r.Context())
+	if err := a.revokeSessions(r.Context(), u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully logged out of all sessions", "")
+}
+
+// Signs the user with the given id out everywhere, e.g. an admin responding
+// to a stolen device
+func (a *App) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+		return
+	}
+
+	u := database.User{ID: id}
+	if err := a.Store.GetUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if err := a.revokeSessions(r.Context(), u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully logged out user with id " + strconv.Itoa(id) + " of all sessions", "")
+}
+
+// Revokes every access and refresh token issued to the user
+func (a *App) revokeSessions(ctx context.Context, u database.User) error {
+	if err := a.Store.RevokeAllTokens(ctx, u.ID, time.Now()); err != nil {
+		return err
+	}
+	return a.Store.RevokeAllRefreshTokens(ctx, u.ID)
 }
 
 // Creates and returns a JWT token if user credentials match those stored in the database
 func (a *App) CreateToken(w http.ResponseWriter, r *http.Request) {
 
 	// Read in user credentials from request body
-	var userCred database.UserCredentials
+	var userCred model.Credentials
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&userCred); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
@@ -143,12 +396,8 @@ func (a *App) CreateToken(w http.ResponseWriter, r *http.Request) {
 
 	// Query user from database based on provided user credentials
 	u := database.User{Username: userCred.Username}
-	if err := u.GetUserByUsername(a.DB); err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, constants.ERROR, "User not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
-		}
+	if err := a.Store.GetUserByUsername(r.Context(), &u); err != nil {
+		renderError(w, r, err)
 		return
 	}
 
@@ -156,45 +405,257 @@ func (a *App) CreateToken(w http.ResponseWriter, r *http.Request) {
 	if crypto.ComparePasswords(u.Hash, []byte(userCred.Password)) {
 
 		// If compare successful, create new JWT token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims {
-			"username": userCred.Username,
-		})
-
-		tokenString, err := token.SignedString([]byte(constants.JWT_SECRET_KEY))
+		tokens, err := a.issueTokens(r.Context(), u, "")
 		if err != nil {
 			log.Println(err)
+			renderError(w, r, err)
+			return
 		}
-		respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, JwtToken{Token: tokenString})
+		respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, tokens)
 	} else {
 		respondWithError(w, http.StatusForbidden, constants.ERROR, "Invalid password")
 	}
 }
 
+// Exchanges a refresh token for a new access token and a rotated refresh token.
+// Presenting a refresh token a second time revokes its whole family, since it
+// means either the client or an attacker holds a stolen copy
+func (a *App) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refresh RefreshRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&refresh); err != nil || refresh.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	rt := database.RefreshToken{TokenHash: crypto.HashToken(refresh.RefreshToken)}
+	if err := a.Store.GetRefreshTokenByHash(r.Context(), &rt); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Invalid refresh token")
+		} else {
+			renderError(w, r, err)
+		}
+		return
+	}
+
+	if rt.Revoked {
+		respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Refresh token has been revoked")
+		return
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Refresh token has expired")
+		return
+	}
+
+	fresh, err := a.Store.MarkRefreshTokenUsed(r.Context(), &rt)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !fresh {
+		if err := a.Store.RevokeRefreshTokenFamily(r.Context(), rt.Family); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Refresh token reuse detected")
+		return
+	}
+
+	u := database.User{ID: rt.UserID}
+	if err := a.Store.GetUser(r.Context(), &u); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusUnauthorized, constants.ERROR, "User no longer exists")
+		} else {
+			renderError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), u, rt.Family)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, tokens)
+}
+
+// Issues a short-lived access token and a refresh token for the given user.
+// An empty family starts a new refresh token family
+func (a *App) issueTokens(ctx context.Context, u database.User, family string) (JwtToken, error) {
+	tokenString, expiresAt, err := a.generateToken(u)
+	if err != nil {
+		return JwtToken{}, err
+	}
+
+	if family == "" {
+		if family, err = crypto.RandomToken(16); err != nil {
+			return JwtToken{}, err
+		}
+	}
+
+	refreshToken, err := crypto.RandomToken(32)
+	if err != nil {
+		return JwtToken{}, err
+	}
+
+	rt := database.RefreshToken{
+		TokenHash: crypto.HashToken(refreshToken),
+		Family: family,
+		UserID: u.ID,
+		ExpiresAt: time.Now().Add(a.Config.Auth.RefreshTokenTTL),
+	}
+	if err := a.Store.CreateRefreshToken(ctx, &rt); err != nil {
+		return JwtToken{}, err
+	}
+
+	return JwtToken{Token: tokenString, ExpiresAt: expiresAt.Unix(), RefreshToken: refreshToken}, nil
+}
+
+// Signs a new short-lived JWT token with a unique ID for the given user
+func (a *App) generateToken(u database.User) (string, time.Time, error) {
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(a.Config.Auth.AccessTokenTTL)
+	tokenString, err := a.Keys.Sign(jwt.MapClaims {
+		"sub": strconv.Itoa(u.ID),
+		"username": u.Username,
+		"jti": jti,
+		// Sub-second precision, so a token issued right after a "sign out
+		// everywhere" isn't mistaken for one issued before it
+		"iat": float64(now.UnixNano()) / 1e9,
+		"nbf": now.Unix(),
+		"exp": expiresAt.Unix(),
+	})
+	return tokenString, expiresAt, err
+}
+
+// Parses and verifies a JWT token, returning its claims
+func (a *App) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, a.Keys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+
+	// Tokens without an ID, issue time or expiry can never be revoked, so refuse them
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+	if _, ok := claims["jti"].(string); !ok {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+	if _, ok := claims["username"].(string); !ok {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+	if sub, ok := claims["sub"].(string); !ok || sub == "" {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+	if _, ok := claims["iat"].(float64); !ok {
+		return nil, fmt.Errorf("Invalid authorization token")
+	}
+
+	return claims, nil
+}
+
+// Publishes the public signing keys as a JSON Web Key Set so other services
+// can verify our tokens. Served bare rather than in a JsonRsp, as JWKS
+// clients expect
+func (a *App) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	response, _ := json.Marshal(a.Keys.JWKS())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// Returns the token from a "Bearer <token>" Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	bearerToken := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(bearerToken) != 2 {
+		return "", false
+	}
+	return bearerToken[1], true
+}
+
+// Bounds the store work of every request by the configured query timeout.
+// Store calls made with the request's context fail once it runs out
+func (a *App) TimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), a.Config.Database.QueryTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // Validation middleware to wrap protected endpoint handler
-func ValidateMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (a *App) ValidateMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader != "" {
-			bearerToken := strings.Split(authorizationHeader, " ")
-			if len(bearerToken) == 2 {
-                token, error := jwt.Parse(bearerToken[1], func(token *jwt.Token) (interface{}, error) {
-                    if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-                        return nil, fmt.Errorf("There was an error")
-                    }
-                    return []byte(constants.JWT_SECRET_KEY), nil
-                })
+			if tokenString, ok := bearerToken(r); ok {
+                claims, error := a.parseToken(tokenString)
+                if ve, ok := error.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+                    respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Authorization token has expired")
+                    return
+                }
                 if error != nil {
                     respondWithError(w, http.StatusBadRequest, constants.ERROR, error.Error())
                     return
                 }
-                if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-                	// TODO: do something with claims
-                	// fmt.Println(claims["username"])
-                	// fmt.Println(bearerToken[1])
-                	next(w, r)
-                } else {
-                    respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid authorization token")
+
+                // Tokens are tied to the account by ID rather than username,
+                // which a rename changes or frees up for someone else
+                id, err := strconv.Atoi(claims["sub"].(string))
+                if err != nil {
+                	respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid authorization token")
+                	return
+                }
+
+                // Reject tokens that were logged out or signed out everywhere
+                issuedAt := time.Unix(0, int64(claims["iat"].(float64) * 1e9))
+                revoked, err := a.Store.IsTokenRevoked(r.Context(), claims["jti"].(string), id, issuedAt)
+                if err != nil {
+                	renderError(w, r, err)
+                	return
+                }
+                if revoked {
+                	respondWithError(w, http.StatusUnauthorized, constants.ERROR, "Authorization token has been revoked")
+                	return
+                }
+
+                // Resolve the caller and hand it to the handler through the
+                // request context
+                u := database.User{ID: id}
+                if err := a.Store.GetUser(r.Context(), &u); err != nil {
+                	if errors.Is(err, database.ErrNotFound) {
+                		respondWithError(w, http.StatusUnauthorized, constants.ERROR, "User no longer exists")
+                	} else {
+                		renderError(w, r, err)
+                	}
+                	return
+                }
+                u.Hash = ""
+
+                principal := &auth.Principal{
+                	User: u,
+                	TokenID: claims["jti"].(string),
+                	IssuedAt: issuedAt,
+                	ExpiresAt: time.Unix(int64(claims["exp"].(float64)), 0),
                 }
+                next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+            } else {
+                respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid authorization header")
             }
         } else {
             respondWithError(w, http.StatusBadRequest, constants.ERROR, "An authorization header is required")
@@ -211,36 +672,64 @@ func (a *App) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	u := database.User{ID: id}
-	if err := u.GetUser(a.DB); err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, constants.ERROR, "User not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
-		}
+	if err := a.Store.GetUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewUser(u))
+}
+
+// Lists every account for admins, optionally only those with ?role=
+func (a *App) GetUsers(w http.ResponseWriter, r *http.Request) {
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, u)
+	role := r.FormValue("role")
+	if role != "" && !database.ValidRole(role) {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid role")
+		return
+	}
+
+	users, page, err := a.Store.GetUsers(r.Context(), role, p)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithPage(w, model.NewUsers(users), page)
 }
 
 func (a *App) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var u database.User
+	var req model.CreateUserRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&u); err != nil {
+	if err := decoder.Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
 
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	if !a.checkUserUnique(w, r, req.Username, req.Email, 0) {
+		return
+	}
+
 	// Hash user password
-	u.Hash = crypto.HashAndSalt([]byte(u.Hash))
+	u := req.ToRow(crypto.HashAndSalt([]byte(req.Password)))
 
-	if err := u.CreateUser(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+	if err := a.Store.CreateUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, u)
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewUser(u))
 }
 
 func (a *App) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -251,21 +740,98 @@ func (a *App) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var u database.User
+	var req model.UpdateUserRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	u := database.User{ID: id}
+	if err := a.Store.GetUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	// Only admins may change roles
+	caller, _ := auth.UserFrom(r.Context())
+	if err := req.Apply(&u, caller.IsAdmin()); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	if !a.checkUserUnique(w, r, u.Username, u.Email, id) {
+		return
+	}
+
+	if err := a.Store.UpdateUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewUser(u))
+}
+
+// Changes a user's password after checking the current one, then signs the
+// user out everywhere and hands back fresh tokens for this session. Admins
+// resetting someone else's password don't need theirs and get no tokens
+func (a *App) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid user ID")
+		return
+	}
+
+	var req model.PasswordChangeRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&u); err != nil {
+	if err := decoder.Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
-	
-	u.ID = id
-	if err := u.UpdateUser(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+
+	if err := model.ValidatePassword(req.NewPassword); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	u := database.User{ID: id}
+	if err := a.Store.GetUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	self := auth.UserID(r.Context()) == id
+	if self && !crypto.ComparePasswords(u.Hash, []byte(req.CurrentPassword)) {
+		respondWithError(w, http.StatusForbidden, constants.ERROR, "Invalid password")
+		return
+	}
+
+	u.Hash = crypto.HashAndSalt([]byte(req.NewPassword))
+	if err := a.Store.UpdatePassword(r.Context(), &u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if err := a.revokeSessions(r.Context(), u); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if !self {
+		respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully changed password", "")
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), u, "")
+	if err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, u)
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully changed password", tokens)
 }
 
 func (a *App) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -277,12 +843,12 @@ func (a *App) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	u := database.User{ID: id}
-	if err := u.DeleteUser(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+	if err := a.Store.DeleteUser(r.Context(), &u); err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted user with id " + string(id), "")
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted user with id " + strconv.Itoa(id), "")
 }
 
 func (a *App) GetTruck(w http.ResponseWriter, r *http.Request) {
@@ -296,53 +862,143 @@ func (a *App) GetTruck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	t := database.Truck{ID: id}
-	if err := t.GetTruck(a.DB); err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, constants.ERROR, "Truck not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
-		}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, t)
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewTruck(t, a.Config.Trucks.LocationStaleAfter))
 }
 
-func (a *App) GetTrucks(w http.ResponseWriter, r *http.Request) {
-	count, _ := strconv.Atoi(r.FormValue("count"))
-	start, _ := strconv.Atoi(r.FormValue("start"))
+// Reads the count, cursor and total paging parameters. Counts outside
+// 1..paging.maxPageSize and cursors that can't be decoded are rejected
+func (a *App) pageParams(r *http.Request) (database.PageRequest, error) {
+	p := database.PageRequest{Limit: a.Config.Paging.DefaultPageSize}
+
+	if r.FormValue("start") != "" {
+		return p, fmt.Errorf("start is no longer supported, pass the cursor of the previous page instead")
+	}
+	if v := r.FormValue("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 1 || count > a.Config.Paging.MaxPageSize {
+			return p, fmt.Errorf("count must be a number between 1 and %d", a.Config.Paging.MaxPageSize)
+		}
+		p.Limit = count
+	}
+	if v := r.FormValue("cursor"); v != "" {
+		cursor, err := database.ParseCursor(v)
+		if err != nil {
+			return p, fmt.Errorf("Invalid cursor")
+		}
+		p.Cursor = cursor
+	}
+	if v := r.FormValue("total"); v != "" {
+		total, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("total must be true or false")
+		}
+		p.Total = total
+	}
+
+	return p, nil
+}
 
-	if count > 10 || count < 1 {
-		count = 10
+// Returns a page of trucks. Query parameters: q searches names, cuisines and
+// descriptions, cuisine, minRating and openNow=true filter, and sort is one of
+// database.TruckSorts
+func (a *App) GetTrucks(w http.ResponseWriter, r *http.Request) {
+	p, err := a.pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
 	}
 
-	if start < 0 {
-		start = 0
+	filter, err := truckFilterParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+	if p.Total && !filter.OpenAt.IsZero() {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, "total can't be combined with openNow")
+		return
 	}
 
-	trucks, err := database.GetTrucks(a.DB, start, count)
+	trucks, page, err := a.Store.GetTrucks(r.Context(), filter, p)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, trucks)
+	respondWithPage(w, model.NewTrucks(trucks, a.Config.Trucks.LocationStaleAfter), page)
+}
+
+func truckFilterParams(r *http.Request) (database.TruckFilter, error) {
+	filter := database.TruckFilter{
+		Search: strings.TrimSpace(r.FormValue("q")),
+		Cuisine: strings.ToLower(strings.TrimSpace(r.FormValue("cuisine"))),
+		Sort: r.FormValue("sort"),
+	}
+	if filter.Sort != "" && !database.ValidTruckSort(filter.Sort) {
+		return filter, fmt.Errorf("sort must be one of %s", strings.Join(database.TruckSorts(), ", "))
+	}
+	if v := r.FormValue("minRating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return filter, fmt.Errorf("minRating must be a number between 0 and 5")
+		}
+		filter.MinRating = rating
+	}
+	if v := r.FormValue("openNow"); v != "" {
+		openNow, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("openNow must be true or false")
+		}
+		if openNow {
+			filter.OpenAt = time.Now()
+		}
+	}
+	return filter, nil
 }
 
 func (a *App) CreateTruck(w http.ResponseWriter, r *http.Request) {
-	var t database.Truck
+	var req model.TruckRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&t); err != nil {
+	if err := decoder.Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
 
-	if err := t.CreateTruck(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	var t database.Truck
+	if err := req.Apply(&t); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	// Trucks belong to whoever creates them, unless an admin names an owner
+	caller, _ := auth.UserFrom(r.Context())
+	t.OwnerID = caller.ID
+	if req.OwnerID != 0 && caller.IsAdmin() {
+		t.OwnerID = req.OwnerID
+	}
+
+	// The owner is only marked as having a truck if the truck is saved
+	err := a.Store.WithTx(r.Context(), func(s database.Store) error {
+		if err := s.CreateTruck(r.Context(), &t); err != nil {
+			return err
+		}
+		return s.SetHasTruck(r.Context(), &database.User{ID: t.OwnerID})
+	})
+	if err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, t)
+	respondWithJSON(w, http.StatusCreated, constants.SUCCESS, constants.NA, model.NewTruck(t, a.Config.Trucks.LocationStaleAfter))
 }
 
 func (a *App) UpdateTruck(w http.ResponseWriter, r *http.Request) {
@@ -353,21 +1009,47 @@ func (a *App) UpdateTruck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var t database.Truck
+	var req model.TruckRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&t); err != nil {
+	if err := decoder.Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, constants.ERROR, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
-	
-	t.ID = id
-	if err := t.UpdateTruck(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+
+	t := database.Truck{ID: id}
+	if err := a.Store.GetTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if err := req.Apply(&t); err != nil {
+		respondWithError(w, http.StatusBadRequest, constants.ERROR, err.Error())
+		return
+	}
+
+	// Only admins may hand a truck over to another owner, who then owns a
+	// truck just like someone who created one
+	caller, _ := auth.UserFrom(r.Context())
+	newOwner := req.OwnerID != 0 && req.OwnerID != t.OwnerID && caller.IsAdmin()
+	if newOwner {
+		t.OwnerID = req.OwnerID
+	}
+
+	err = a.Store.WithTx(r.Context(), func(s database.Store) error {
+		if err := s.UpdateTruck(r.Context(), &t); err != nil {
+			return err
+		}
+		if !newOwner {
+			return nil
+		}
+		return s.SetHasTruck(r.Context(), &database.User{ID: t.OwnerID})
+	})
+	if err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, t)
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, constants.NA, model.NewTruck(t, a.Config.Trucks.LocationStaleAfter))
 }
 
 func (a *App) DeleteTruck(w http.ResponseWriter, r *http.Request) {
@@ -379,43 +1061,41 @@ func (a *App) DeleteTruck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	t := database.Truck{ID: id}
-	if err := t.DeleteTruck(a.DB); err != nil {
-		respondWithError(w, http.StatusInternalServerError, constants.ERROR, err.Error())
+	if err := a.Store.DeleteTruck(r.Context(), &t); err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted truck with id " + string(id), "")
+	respondWithJSON(w, http.StatusOK, constants.SUCCESS, "Successfully deleted truck with id " + strconv.Itoa(id), "")
 }
 
-func (a *App) GetOrdersForUser(w http.ResponseWriter, r *http.Request) {
-	// TODO
-}
+func main() {
+	// certPath := "server.pem"
+	// keyPath := "server.key"
 
-func (a *App) GetOrdersForTruck(w http.ResponseWriter, r *http.Request) {
-	// TODO
-}
+	configPath := flag.String("config", os.Getenv("APP_CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
 
-func (a *App) CreateOrderForTruck(w http.ResponseWriter, r *http.Request) {
-	// TODO
-}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func (a *App) UpdateOrderForTruck(w http.ResponseWriter, r *http.Request) {
-	// TODO
-}
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func (a *App) DeleteOrderForTruck(w http.ResponseWriter, r *http.Request) {
-	// TODO
-}
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-func main() {
-	// certPath := "server.pem"
-	// keyPath := "server.key"
+	migrateUp(db)
 
 	a := App{}
-    a.Initialize(
-        os.Getenv("APP_DB_USERNAME"),
-        os.Getenv("APP_DB_PASSWORD"), /* munchbunch */
-        os.Getenv("APP_DB_NAME"))
-    a.CheckTablesExist()
-    a.Run(":8080")
+    a.Initialize(cfg, database.NewPostgres(db))
+    a.Run(cfg.Server.Addr)
 }
\ No newline at end of file
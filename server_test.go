@@ -2,25 +2,69 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/Nagoogin/munch-bunch-rest-api/config"
 	"github.com/Nagoogin/munch-bunch-rest-api/crypto"
+	"github.com/Nagoogin/munch-bunch-rest-api/database"
 )
 
 var a App
 
+// The database when the tests run against Postgres, which they do when
+// TEST_DB_NAME is set. Otherwise it's nil and they use the in-memory store
+var testDB *sql.DB
+
 func clearTableTrucks() {
-    a.DB.Exec("DELETE FROM trucks")
-    a.DB.Exec("ALTER SEQUENCE trucks_id_seq RESTART WITH 1")
+	if testDB == nil {
+		a.Store.(*database.Memory).ClearTrucks()
+		return
+	}
+    testDB.Exec("DELETE FROM trucks")
+    testDB.Exec("ALTER SEQUENCE trucks_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE truck_locations_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE menu_items_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE menus_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE menu_categories_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE menu_option_groups_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE menu_options_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE truck_schedule_slots_id_seq RESTART WITH 1")
+    testDB.Exec("ALTER SEQUENCE truck_schedule_events_id_seq RESTART WITH 1")
+    clearTableOrders()
+}
+
+func clearTableOrders() {
+	testDB.Exec("DELETE FROM orders")
+	testDB.Exec("ALTER SEQUENCE orders_id_seq RESTART WITH 1")
+	testDB.Exec("ALTER SEQUENCE order_items_id_seq RESTART WITH 1")
+	testDB.Exec("ALTER SEQUENCE order_status_history_id_seq RESTART WITH 1")
+	testDB.Exec("ALTER SEQUENCE order_item_options_id_seq RESTART WITH 1")
+	testDB.Exec("ALTER SEQUENCE reviews_id_seq RESTART WITH 1")
 }
 
 func clearTableUsers() {
-	a.DB.Exec("DELETE FROM users")
-	a.DB.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1")
+	if testDB == nil {
+		a.Store.(*database.Memory).ClearUsers()
+		return
+	}
+	testDB.Exec("DELETE FROM users")
+	testDB.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1")
+	testDB.Exec("DELETE FROM token_denylist")
+	testDB.Exec("DELETE FROM token_cutoffs")
+	testDB.Exec("DELETE FROM refresh_tokens")
 }
 
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
@@ -36,30 +80,75 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 	}
 }
 
-func addUsers(count int) {
+func addUsers(t *testing.T, count int) {
 	if count < 1 {
 		count = 1
 	}
 	for i := 0; i < count; i++ {
-		a.DB.Exec("INSERT INTO users(username, hash, fname, lname, email, hasTruck) VALUES($1, $2, $3, $4, $5, $6)",
-			"User" + strconv.Itoa(i), crypto.HashAndSalt([]byte("password")), "first-name", "last-name", "email@test.com", false)
+		err := a.Store.CreateUser(context.Background(), &database.User{
+			Username: "User" + strconv.Itoa(i),
+			Hash: crypto.HashAndSalt([]byte("password")),
+			Fname: "first-name",
+			Lname: "last-name",
+			Email: "User" + strconv.Itoa(i) + "@test.com",
+		})
+		if err != nil {
+			t.Fatalf("Expected to add User%d. Got '%v'", i, err)
+		}
 	}
 }
 
+func addUser(username, role string) {
+	a.Store.CreateUser(context.Background(), &database.User{
+		Username: username,
+		Hash: crypto.HashAndSalt([]byte("password")),
+		Fname: "first-name",
+		Lname: "last-name",
+		Email: username + "@test.com",
+		HasTruck: role == database.RoleTruckOwner,
+		Role: role,
+	})
+}
+
+// Adds trucks owned by the user with id 1, if there is one
 func addTrucks(count int) {
 	if count < 1 {
 		count = 1
 	}
+	owner := database.User{ID: 1}
+	if err := a.Store.GetUser(context.Background(), &owner); err != nil {
+		owner.ID = 0
+	}
 	for i := 0; i < count; i++ {
-		a.DB.Exec("INSERT INTO trucks(name) VALUES($1)", "Truck " + strconv.Itoa(i))
+		a.Store.CreateTruck(context.Background(), &database.Truck{Name: "Truck " + strconv.Itoa(i), OwnerID: owner.ID})
 	}
 }
 
-func getJWT() string {
-	clearTableUsers()
-	addUsers(1)
+func addMenuItem(truckID int, name string, priceCents int, available bool) {
+	a.Store.CreateMenuItem(context.Background(), &database.MenuItem{TruckID: truckID, Name: name, PriceCents: priceCents, Available: available})
+}
 
-	payload := []byte(`{"username":"User0","password":"password"}`)
+// Sets up truck 1 owned by User0 (id 1) with two menu items, and returns
+// tokens for the owner and for User1, a customer with id 2
+func setUpOrdering() (string, string) {
+	clearTableTrucks()
+	ownerJWT := getJWT()
+	addTrucks(1)
+	addMenuItem(1, "Burrito", 850, true)
+	addMenuItem(1, "Horchata", 300, true)
+	addUser("User1", database.RoleCustomer)
+
+	return ownerJWT, authenticate("User1")
+}
+
+func placeOrder(jwt string, payload []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/v1/truck/1/orders", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func authenticate(username string) string {
+	payload := []byte(`{"username":"` + username + `","password":"password"}`)
 	req, _ := http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
@@ -69,13 +158,42 @@ func getJWT() string {
 	return "Bearer " + m["data"].(map[string]interface{})["token"].(string)
 }
 
+// Returns a token for User0, a truck owner with id 1
+func getJWT() string {
+	clearTableUsers()
+	addUser("User0", database.RoleTruckOwner)
+
+	return authenticate("User0")
+}
+
+// Returns a token for Admin, an admin with id 1
+func getAdminJWT() string {
+	clearTableUsers()
+	addUser("Admin", database.RoleAdmin)
+
+	return authenticate("Admin")
+}
+
 func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.Database.User = os.Getenv("TEST_DB_USERNAME")
+	cfg.Database.Password = os.Getenv("TEST_DB_PASSWORD")
+	cfg.Database.Name = os.Getenv("TEST_DB_NAME")
+	cfg.Auth.SigningKey = "test-signing-key-0123456789"
+
+	var store database.Store = database.NewMemory()
+	if cfg.Database.Name != "" {
+		var err error
+		testDB, err = openDB(cfg.Database)
+		if err != nil {
+			log.Fatal(err)
+		}
+		migrateUp(testDB)
+		store = database.NewPostgres(testDB)
+	}
+
 	a = App{}
-	a.Initialize(
-		os.Getenv("TEST_DB_USERNAME"),
-		os.Getenv("TEST_DB_PASSWORD"),
-		os.Getenv("TEST_DB_NAME"))
-	a.CheckTablesExist()
+	a.Initialize(cfg, store)
 	code := m.Run()
 	clearTableTrucks()
 	os.Exit(code)
@@ -85,7 +203,7 @@ func TestMain(m *testing.M) {
 
 func TestAuthenticate(t *testing.T) {
 	clearTableUsers()
-	addUsers(1)
+	addUsers(t, 1)
 
 	payload := []byte(`{"username":"User0","password":"password"}`)
 	req, _ := http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
@@ -100,6 +218,186 @@ func TestAuthenticate(t *testing.T) {
 	}
 }
 
+func TestRegister(t *testing.T) {
+	clearTableUsers()
+
+	payload := []byte(`{"username":"User1","password":"password","fname":"first-name","lname":"last-name","email":"email@test.com"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	data := m["data"].(map[string]interface{})
+	if data["user"].(map[string]interface{})["username"] != "User1" {
+		t.Errorf("Expected username to be 'User1'. Got '%v'", data["user"].(map[string]interface{})["username"])
+	}
+	if _, ok := data["user"].(map[string]interface{})["hash"]; ok {
+		t.Errorf("Expected the hash not to be returned")
+	}
+	if data["token"] == "" {
+		t.Errorf("Expected a JWT in the response")
+	}
+}
+
+func TestRegisterDuplicateUsername(t *testing.T) {
+	clearTableUsers()
+	addUsers(t, 1)
+
+	payload := []byte(`{"username":"User0","password":"password","fname":"first-name","lname":"last-name","email":"other@test.com"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusConflict, response.Code)
+}
+
+func TestRegisterCannotClaimTruck(t *testing.T) {
+	clearTableUsers()
+
+	payload := []byte(`{"username":"User1","password":"password","fname":"first-name","lname":"last-name","email":"email@test.com","hasTruck":true}`)
+	req, _ := http.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	user := m["data"].(map[string]interface{})["user"].(map[string]interface{})
+	if user["hasTruck"] != false {
+		t.Errorf("Expected hasTruck to be false. Got '%v'", user["hasTruck"])
+	}
+	if user["role"] != database.RoleCustomer {
+		t.Errorf("Expected the role to be '%s'. Got '%v'", database.RoleCustomer, user["role"])
+	}
+}
+
+func TestLogout(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	jwt := getJWT()
+	req, _ := http.NewRequest("POST", "/api/v1/auth/logout", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	jwt := getJWT()
+	other := getJWT()
+	req, _ := http.NewRequest("POST", "/api/v1/auth/logout-all", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", other)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestRefreshToken(t *testing.T) {
+	clearTableUsers()
+	addUsers(t, 1)
+
+	payload := []byte(`{"username":"User0","password":"password"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	refreshToken := m["data"].(map[string]interface{})["refreshToken"].(string)
+
+	payload = []byte(`{"refreshToken":"` + refreshToken + `"}`)
+	req, _ = http.NewRequest("POST", "/api/v1/auth/refresh", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &m)
+	rotated := m["data"].(map[string]interface{})["refreshToken"].(string)
+	if rotated == refreshToken {
+		t.Errorf("Expected the refresh token to be rotated")
+	}
+
+	// Reusing the first refresh token kills the family, including the rotated token
+	req, _ = http.NewRequest("POST", "/api/v1/auth/refresh", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	payload = []byte(`{"refreshToken":"` + rotated + `"}`)
+	req, _ = http.NewRequest("POST", "/api/v1/auth/refresh", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestRefreshTokenForDeletedUser(t *testing.T) {
+	jwt := getAdminJWT()
+	addUser("User0", database.RoleCustomer)
+
+	payload := []byte(`{"username":"User0","password":"password"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	refreshToken := m["data"].(map[string]interface{})["refreshToken"].(string)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	// Someone else taking the username doesn't inherit the deleted user's session
+	addUser("User0", database.RoleCustomer)
+
+	payload = []byte(`{"refreshToken":"` + refreshToken + `"}`)
+	req, _ = http.NewRequest("POST", "/api/v1/auth/refresh", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestExpiredToken(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	issued := time.Now().Add(-2 * a.Config.Auth.AccessTokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims {
+		"username": "User0",
+		"jti": "expired",
+		"iat": issued.Unix(),
+		"nbf": issued.Unix(),
+		"exp": issued.Add(a.Config.Auth.AccessTokenTTL).Unix(),
+	})
+	tokenString, _ := token.SignedString([]byte(a.Config.Auth.SigningKey))
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", "Bearer " + tokenString)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestTokenForDeletedUser(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	jwt := getJWT()
+	clearTableUsers()
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
 func TestValidationMiddleware(t *testing.T) {
 	clearTableTrucks()
 	addTrucks(1)
@@ -114,9 +412,10 @@ func TestValidationMiddleware(t *testing.T) {
 // User endpoint tests
 
 func TestGetNonExistentUser(t *testing.T) {
-	clearTableUsers()
+	jwt := getAdminJWT()
 
-	req, _ := http.NewRequest("GET", "/api/v1/user/1", nil)
+	req, _ := http.NewRequest("GET", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
 
 	checkResponseCode(t, http.StatusNotFound, response.Code)
@@ -129,20 +428,42 @@ func TestGetNonExistentUser(t *testing.T) {
 }
 
 func TestGetUser(t *testing.T) {
-	clearTableUsers()
-	addUsers(1)
+	jwt := getJWT()
 
 	req, _ := http.NewRequest("GET", "/api/v1/user/1", nil)
+	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
 
 	checkResponseCode(t, http.StatusOK, response.Code)
 }
 
-func TestCreateUser(t *testing.T) {
+func TestGetOtherUserForbidden(t *testing.T) {
+	jwt := getJWT()
+	addUser("User1", database.RoleCustomer)
+
+	req, _ := http.NewRequest("GET", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func TestGetUserUnauthenticated(t *testing.T) {
 	clearTableUsers()
+	addUsers(t, 1)
+
+	req, _ := http.NewRequest("GET", "/api/v1/user/1", nil)
+	response := executeRequest(req)
 
-	payload := []byte(`{"username":"User1","hash":"password","fname":"first-name","lname":"last-name","email":"email@test.com"}`)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestCreateUser(t *testing.T) {
+	jwt := getAdminJWT()
+
+	payload := []byte(`{"username":"User1","password":"password","fname":"first-name","lname":"last-name","email":"email@test.com"}`)
 	req, _ := http.NewRequest("POST", "/api/v1/user", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
 
 	checkResponseCode(t, http.StatusCreated, response.Code)
@@ -153,8 +474,8 @@ func TestCreateUser(t *testing.T) {
 	if m["data"].(map[string]interface{})["username"] != "User1" {
 		t.Errorf("Expected username to be 'User1'. Got '%v'", m["data"].(map[string]interface{})["username"])
 	}
-	if !crypto.ComparePasswords(m["data"].(map[string]interface{})["hash"].(string), []byte("password")) {
-		t.Errorf("Unexpected password")
+	if _, ok := m["data"].(map[string]interface{})["hash"]; ok {
+		t.Errorf("Expected the hash not to be returned")
 	}
 	if m["data"].(map[string]interface{})["fname"] != "first-name" {
 		t.Errorf("Expected fname to be 'first-name'. Got '%v'", m["data"].(map[string]interface{})["fname"])
@@ -165,23 +486,35 @@ func TestCreateUser(t *testing.T) {
 	if m["data"].(map[string]interface{})["email"] != "email@test.com" {
 		t.Errorf("Expected email to be 'email@test.com'. Got '%v'", m["data"].(map[string]interface{})["email"])
 	}
-	if m["data"].(map[string]interface{})["id"] != 1.0 {
-		t.Errorf("Expected truck ID to be '1'. Got '%v'", m["data"].(map[string]interface{})["id"])
+	if m["data"].(map[string]interface{})["id"] != 2.0 {
+		t.Errorf("Expected user ID to be '2'. Got '%v'", m["data"].(map[string]interface{})["id"])
 	}
 }
 
+func TestCreateUserRequiresAdmin(t *testing.T) {
+	jwt := getJWT()
+
+	payload := []byte(`{"username":"User1","password":"password","fname":"first-name","lname":"last-name","email":"email@test.com"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/user", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
 func TestUpdateUser(t *testing.T) {
-	clearTableUsers()
-	addUsers(1)
+	jwt := getJWT()
 
 	req, _ := http.NewRequest("GET", "/api/v1/user/1", nil)
+	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
 	var originalUser map[string]interface{}
 	json.Unmarshal(response.Body.Bytes(), &originalUser)
 
-	payload := []byte(`{"username":"Updated1","hash":"updated-password","fname":"updated-first-name","lname":"updated-last-name","email":"updated.email@test.com"}`)
+	payload := []byte(`{"username":"Updated1","fname":"updated-first-name","lname":"updated-last-name","email":"updated.email@test.com"}`)
 
 	req, _ = http.NewRequest("PUT", "/api/v1/user/1", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
 	response = executeRequest(req)
 
 	checkResponseCode(t, http.StatusOK, response.Code)
@@ -192,8 +525,8 @@ func TestUpdateUser(t *testing.T) {
 	if m["data"].(map[string]interface{})["id"] != originalUser["data"].(map[string]interface{})["id"] {
 		t.Errorf("Expected the id to remain the unchanged (%v). Got %v", originalUser["data"].(map[string]interface{})["id"], m["data"].(map[string]interface{})["id"])
 	}
-	if m["data"].(map[string]interface{})["hash"] == originalUser["data"].(map[string]interface{})["hash"] {
-		t.Errorf("Expected hash to change from '%v' to '%v'. Got '%v'", originalUser["data"].(map[string]interface{})["hash"], crypto.HashAndSalt([]byte("updated-password")), m["data"].(map[string]interface{})["hash"])
+	if _, ok := m["data"].(map[string]interface{})["hash"]; ok {
+		t.Errorf("Expected the hash not to be returned")
 	}
 	if m["data"].(map[string]interface{})["username"] == originalUser["data"].(map[string]interface{})["username"] {
 		t.Errorf("Expected the username to change from '%v' to 'Updated1'. Got '%v'", originalUser["data"].(map[string]interface{})["username"], m["data"].(map[string]interface{})["username"])
@@ -209,111 +542,527 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
-func TestDeleteUser(t *testing.T) {
-	clearTableUsers()
-	addUsers(1)
+func TestUpdateNonExistentUser(t *testing.T) {
+	jwt := getAdminJWT()
 
-	req, _ := http.NewRequest("GET", "/api/v1/user/1", nil)
+	payload := []byte(`{"username":"User11","fname":"first-name","lname":"last-name","email":"User11@test.com"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/11", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
-	checkResponseCode(t, http.StatusOK, response.Code)
-
-	req, _ = http.NewRequest("DELETE", "/api/v1/user/1", nil)
-	response = executeRequest(req)
-	checkResponseCode(t, http.StatusOK, response.Code)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
 
-	req, _ = http.NewRequest("GET", "/api/v1/user/1", nil)
-	response = executeRequest(req)
-	checkResponseCode(t, http.StatusNotFound, response.Code) 
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["errorCode"] != "user_not_found" {
+		t.Errorf("Expected the error code 'user_not_found'. Got '%v'", m["errorCode"])
+	}
 }
 
-// Truck endpoint tests
+func TestStoreUpdateNonExistentUser(t *testing.T) {
+	clearTableUsers()
 
-func TestEmptyTable(t *testing.T) {
-	clearTableTrucks()
+	err := a.Store.UpdateUser(context.Background(), &database.User{ID: 11, Username: "User11", Email: "User11@test.com", Role: database.RoleCustomer})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected updating a missing user to fail as not found. Got '%v'", err)
+	}
+}
 
+func TestUpdateUserCannotChangeOwnRole(t *testing.T) {
 	jwt := getJWT()
-	req, _ := http.NewRequest("GET", "/api/v1/trucks", nil)
+
+	payload := []byte(`{"username":"User0","fname":"first-name","lname":"last-name","email":"email@test.com","role":"admin"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/1", bytes.NewBuffer(payload))
 	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
-
 	checkResponseCode(t, http.StatusOK, response.Code)
 
 	var m map[string]interface{}
 	json.Unmarshal(response.Body.Bytes(), &m)
-	if len(m["data"].([]interface{})) > 0 {
-		t.Errorf("Expected an empty array. Got %s", m["data"])
+	if m["data"].(map[string]interface{})["role"] != database.RoleTruckOwner {
+		t.Errorf("Expected the role to remain '%s'. Got '%v'", database.RoleTruckOwner, m["data"].(map[string]interface{})["role"])
 	}
 }
 
-func TestGetNonExistentTruck(t *testing.T) {
-	clearTableTrucks()
+func TestUpdateUserCannotSetHasTruck(t *testing.T) {
+	clearTableUsers()
+	addUser("User0", database.RoleCustomer)
+	jwt := authenticate("User0")
 
-	jwt := getJWT()
-	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	payload := []byte(`{"username":"User0","fname":"first-name","lname":"last-name","email":"User0@test.com","hasTruck":true}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/1", bytes.NewBuffer(payload))
 	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
-
-	checkResponseCode(t, http.StatusNotFound, response.Code)
+	checkResponseCode(t, http.StatusOK, response.Code)
 
 	var m map[string]interface{}
 	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["message"].(string) != "Truck not found" {
-		t.Errorf("Expected the 'error' key of the response to be set to 'Truck not found'. Got '%s'", m["message"].(string))
+	if m["data"].(map[string]interface{})["hasTruck"] != false {
+		t.Errorf("Expected hasTruck to remain false. Got '%v'", m["data"].(map[string]interface{})["hasTruck"])
 	}
 }
 
-func TestGetTruck(t *testing.T) {
-	clearTableTrucks()
-	addTrucks(1)
-
+func TestChangePassword(t *testing.T) {
 	jwt := getJWT()
-	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+
+	payload := []byte(`{"currentPassword":"wrong-password","newPassword":"new-password"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/1/password", bytes.NewBuffer(payload))
 	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
 
+	payload = []byte(`{"currentPassword":"password","newPassword":"new-password"}`)
+	req, _ = http.NewRequest("PUT", "/api/v1/user/1/password", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
 	checkResponseCode(t, http.StatusOK, response.Code)
-}
 
-func TestGetTrucks(t *testing.T) {
-	clearTableTrucks()
-	addTrucks(10)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	fresh := "Bearer " + m["data"].(map[string]interface{})["token"].(string)
 
-	jwt := getJWT()
-	req, _ := http.NewRequest("GET", "/api/v1/trucks", nil)
+	// The old session is signed out, the new one works
+	req, _ = http.NewRequest("GET", "/api/v1/user/1", nil)
 	req.Header.Set("Authorization", jwt)
-	response := executeRequest(req)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
 
+	req, _ = http.NewRequest("GET", "/api/v1/user/1", nil)
+	req.Header.Set("Authorization", fresh)
+	response = executeRequest(req)
 	checkResponseCode(t, http.StatusOK, response.Code)
-}
 
-func TestCreateTruck(t *testing.T) {
-	clearTableTrucks()
+	payload = []byte(`{"username":"User0","password":"new-password"}`)
+	req, _ = http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
 
+func TestChangePasswordAfterRename(t *testing.T) {
 	jwt := getJWT()
 
-	payload := []byte(`{"name":"test truck"}`)
-	req, _ := http.NewRequest("POST", "/api/v1/truck", bytes.NewBuffer(payload))
+	payload := []byte(`{"username":"Renamed0","fname":"first-name","lname":"last-name","email":"User0@test.com"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/1", bytes.NewBuffer(payload))
 	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
 
-	checkResponseCode(t, http.StatusCreated, response.Code)
+	payload = []byte(`{"currentPassword":"password","newPassword":"new-password"}`)
+	req, _ = http.NewRequest("PUT", "/api/v1/user/1/password", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
 
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
+	// The token issued under the old username is signed out too
+	req, _ = http.NewRequest("GET", "/api/v1/user/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
 
-	if m["data"].(map[string]interface{})["name"] != "test truck" {
+func TestAdminChangesPassword(t *testing.T) {
+	jwt := getAdminJWT()
+	addUser("User0", database.RoleCustomer)
+	userJWT := authenticate("User0")
+
+	payload := []byte(`{"newPassword":"new-password"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/user/2/password", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"] != "" {
+		t.Errorf("Expected no tokens for the user. Got '%v'", m["data"])
+	}
+
+	// The user is signed out and signs in with the new password
+	req, _ = http.NewRequest("GET", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", userJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	payload = []byte(`{"username":"User0","password":"new-password"}`)
+	req, _ = http.NewRequest("POST", "/api/v1/auth/authenticate", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func TestDeleteUser(t *testing.T) {
+	jwt := getAdminJWT()
+	addUser("User0", database.RoleCustomer)
+
+	req, _ := http.NewRequest("GET", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code) 
+}
+
+func TestDeleteNonExistentUser(t *testing.T) {
+	jwt := getAdminJWT()
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/user/11", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["errorCode"] != "user_not_found" {
+		t.Errorf("Expected the error code 'user_not_found'. Got '%v'", m["errorCode"])
+	}
+}
+
+func TestAdminLogoutUser(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	jwt := getAdminJWT()
+	addUser("User0", database.RoleCustomer)
+	userJWT := authenticate("User0")
+
+	req, _ := http.NewRequest("POST", "/api/v1/user/2/logout-all", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", userJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+// Truck endpoint tests
+
+func TestEmptyTable(t *testing.T) {
+	clearTableTrucks()
+
+	jwt := getJWT()
+	req, _ := http.NewRequest("GET", "/api/v1/trucks", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if len(m["data"].([]interface{})) > 0 {
+		t.Errorf("Expected an empty array. Got %s", m["data"])
+	}
+}
+
+func TestGetNonExistentTruck(t *testing.T) {
+	clearTableTrucks()
+
+	jwt := getJWT()
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["message"].(string) != "Truck not found" {
+		t.Errorf("Expected the 'error' key of the response to be set to 'Truck not found'. Got '%s'", m["message"].(string))
+	}
+	if m["errorCode"] != "truck_not_found" {
+		t.Errorf("Expected the error code 'truck_not_found'. Got '%v'", m["errorCode"])
+	}
+}
+
+func TestGetTruck(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+
+	jwt := getJWT()
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func TestGetTruckTimesOut(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+	jwt := getJWT()
+
+	timeout := a.Config.Database.QueryTimeout
+	a.Config.Database.QueryTimeout = time.Nanosecond
+	defer func() { a.Config.Database.QueryTimeout = timeout }()
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusGatewayTimeout, response.Code)
+}
+
+func TestGetTruckCancelled(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(1)
+	jwt := getJWT()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req.WithContext(ctx))
+
+	checkResponseCode(t, http.StatusServiceUnavailable, response.Code)
+}
+
+func TestGetTrucks(t *testing.T) {
+	clearTableTrucks()
+	addTrucks(10)
+
+	jwt := getJWT()
+	req, _ := http.NewRequest("GET", "/api/v1/trucks", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+// Fetches a page of a listing and returns its ids and paging cursors
+func getPage(t *testing.T, jwt, url string) ([]float64, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	ids := []float64{}
+	for _, item := range m["data"].([]interface{}) {
+		ids = append(ids, item.(map[string]interface{})["id"].(float64))
+	}
+	paging, _ := m["paging"].(map[string]interface{})
+	return ids, paging
+}
+
+func TestPaginateTrucks(t *testing.T) {
+	clearTableTrucks()
+	jwt := getJWT()
+	addTrucks(5)
+
+	ids, paging := getPage(t, jwt, "/api/v1/trucks?count=2&total=true")
+	if fmt.Sprint(ids) != "[1 2]" || paging["prev"] != nil || paging["total"] != 5.0 {
+		t.Fatalf("Expected trucks 1 and 2 of 5 with no prev cursor. Got %v %v", ids, paging)
+	}
+
+	ids, paging = getPage(t, jwt, "/api/v1/trucks?count=2&cursor=" + paging["next"].(string))
+	if fmt.Sprint(ids) != "[3 4]" || paging["prev"] == nil || paging["total"] != nil {
+		t.Fatalf("Expected trucks 3 and 4 with a prev cursor. Got %v %v", ids, paging)
+	}
+	prev := paging["prev"].(string)
+
+	ids, paging = getPage(t, jwt, "/api/v1/trucks?count=2&cursor=" + paging["next"].(string))
+	if fmt.Sprint(ids) != "[5]" || paging["next"] != nil {
+		t.Errorf("Expected truck 5 on the last page. Got %v %v", ids, paging)
+	}
+
+	ids, paging = getPage(t, jwt, "/api/v1/trucks?count=2&cursor=" + prev)
+	if fmt.Sprint(ids) != "[1 2]" || paging["prev"] != nil || paging["next"] == nil {
+		t.Errorf("Expected to page back to trucks 1 and 2. Got %v %v", ids, paging)
+	}
+
+	_, paging = getPage(t, jwt, "/api/v1/trucks?count=2&sort=name")
+	for _, query := range []string{"count=0", "count=51", "count=ten", "start=2", "cursor=garbage", "cursor=" + paging["next"].(string), "total=maybe"} {
+		req, _ := http.NewRequest("GET", "/api/v1/trucks?" + query, nil)
+		req.Header.Set("Authorization", jwt)
+		response := executeRequest(req)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected with %d. Got %d", query, http.StatusBadRequest, response.Code)
+		}
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	jwt := getAdminJWT()
+	addUser("User1", database.RoleCustomer)
+	addUser("User2", database.RoleTruckOwner)
+	addUser("User3", database.RoleCustomer)
+
+	ids, paging := getPage(t, jwt, "/api/v1/users?role=customer&count=1")
+	if len(ids) != 1 || paging["next"] == nil {
+		t.Fatalf("Expected one customer and a next cursor. Got %v %v", ids, paging)
+	}
+	more, paging := getPage(t, jwt, "/api/v1/users?role=customer&count=1&cursor=" + paging["next"].(string))
+	if len(more) != 1 || more[0] <= ids[0] || paging["next"] != nil {
+		t.Errorf("Expected the second and last customer. Got %v %v", more, paging)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	req.Header.Set("Authorization", authenticate("User1"))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}
+
+func TestCreateTruck(t *testing.T) {
+	clearTableTrucks()
+
+	jwt := getJWT()
+
+	payload := []byte(`{"name":"test truck"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/truck", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	if m["data"].(map[string]interface{})["name"] != "test truck" {
 		t.Errorf("Expected truck name to be 'test truck'. Got '%v'", m["data"].(map[string]interface{})["name"])
 	}
 	if m["data"].(map[string]interface{})["id"] != 1.0 {
 		t.Errorf("Expected truck ID to be '1'. Got '%v'", m["data"].(map[string]interface{})["id"])
 	}
+	if m["data"].(map[string]interface{})["ownerId"] != 1.0 {
+		t.Errorf("Expected truck owner ID to be '1'. Got '%v'", m["data"].(map[string]interface{})["ownerId"])
+	}
 }
 
-func TestUpdateTruck(t *testing.T) {
+func TestStoreTransaction(t *testing.T) {
+	clearTableTrucks()
+	ctx := context.Background()
+
+	var committed database.Truck
+	err := a.Store.WithTx(ctx, func(s database.Store) error {
+		committed = database.Truck{Name: "Committed truck"}
+		return s.CreateTruck(ctx, &committed)
+	})
+	if err != nil {
+		t.Fatalf("Expected the transaction to commit. Got '%v'", err)
+	}
+	if err := a.Store.GetTruck(ctx, &database.Truck{ID: committed.ID}); err != nil {
+		t.Errorf("Expected the committed truck to exist. Got '%v'", err)
+	}
+
+	failure := fmt.Errorf("failed after creating the truck")
+	var failed database.Truck
+	err = a.Store.WithTx(ctx, func(s database.Store) error {
+		failed = database.Truck{Name: "Failed truck"}
+		if err := s.CreateTruck(ctx, &failed); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected the transaction to return the error of its function. Got '%v'", err)
+	}
+	if err := a.Store.GetTruck(ctx, &database.Truck{ID: failed.ID}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected the truck of the failed transaction to be rolled back. Got '%v'", err)
+	}
+
+	var panicked database.Truck
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the transaction to pass the panic on")
+			}
+		}()
+		a.Store.WithTx(ctx, func(s database.Store) error {
+			panicked = database.Truck{Name: "Panicked truck"}
+			s.CreateTruck(ctx, &panicked)
+			panic("panicked after creating the truck")
+		})
+	}()
+	if err := a.Store.GetTruck(ctx, &database.Truck{ID: panicked.ID}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected the truck of the panicked transaction to be rolled back. Got '%v'", err)
+	}
+}
+
+func TestCreateTruckForMissingOwner(t *testing.T) {
+	clearTableTrucks()
+	jwt := getAdminJWT()
+
+	payload := []byte(`{"name":"test truck","ownerId":999}`)
+	req, _ := http.NewRequest("POST", "/api/v1/truck", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["errorCode"] != "invalid_reference" {
+		t.Errorf("Expected the error code 'invalid_reference'. Got '%v'", m["errorCode"])
+	}
+}
+
+func TestStoreUniqueUsers(t *testing.T) {
+	clearTableUsers()
+	ctx := context.Background()
+	addUser("User0", database.RoleCustomer)
+
+	tests := []struct {
+		user 	database.User
+		code 	string
+	}{
+		{database.User{Username: "User0", Email: "other@test.com", Role: database.RoleCustomer}, "username_taken"},
+		{database.User{Username: "User1", Email: "USER0@test.com", Role: database.RoleCustomer}, "email_taken"},
+	}
+
+	for _, test := range tests {
+		err := a.Store.CreateUser(ctx, &test.user)
+		var e *database.Error
+		if !errors.Is(err, database.ErrConflict) || !errors.As(err, &e) || e.Code != test.code {
+			t.Errorf("Expected a conflict coded '%s' creating %s. Got '%v'", test.code, test.user.Username, err)
+		}
+	}
+}
+
+func TestCustomerCannotCreateTruck(t *testing.T) {
 	clearTableTrucks()
+	clearTableUsers()
+	addUser("User0", database.RoleCustomer)
+	jwt := authenticate("User0")
+
+	payload := []byte(`{"name":"test truck"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/truck", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func TestUpdateTruckNotOwner(t *testing.T) {
+	clearTableTrucks()
+	getJWT()
 	addTrucks(1)
+	addUser("User1", database.RoleTruckOwner)
+	jwt := authenticate("User1")
+
+	payload := []byte(`{"name":"Updated truck 1"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
 
+func TestUpdateTruck(t *testing.T) {
+	clearTableTrucks()
 	jwt := getJWT()
+	addTrucks(1)
+
 	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
 	req.Header.Set("Authorization", jwt)
 	response := executeRequest(req)
@@ -339,23 +1088,866 @@ func TestUpdateTruck(t *testing.T) {
 	}
 }
 
-func TestDeleteTruck(t *testing.T) {
+func updateTruck(jwt, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func TestAdminChangesTruckOwner(t *testing.T) {
 	clearTableTrucks()
+	jwt := getAdminJWT()
 	addTrucks(1)
+	addUser("User1", database.RoleCustomer)
 
-	jwt := getJWT()
-	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
-	req.Header.Set("Authorization", jwt)
-	response := executeRequest(req)
+	response := updateTruck(jwt, `{"ownerId":2}`)
 	checkResponseCode(t, http.StatusOK, response.Code)
 
-	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1", nil)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["ownerId"] != 2.0 {
+		t.Errorf("Expected truck owner ID to be '2'. Got '%v'", m["data"].(map[string]interface{})["ownerId"])
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/user/2", nil)
 	req.Header.Set("Authorization", jwt)
 	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["hasTruck"] != true {
+		t.Errorf("Expected the new owner to have a truck. Got '%v'", m["data"].(map[string]interface{})["hasTruck"])
+	}
+	if m["data"].(map[string]interface{})["role"] != database.RoleTruckOwner {
+		t.Errorf("Expected the new owner's role to be '%s'. Got '%v'", database.RoleTruckOwner, m["data"].(map[string]interface{})["role"])
+	}
+
+	response = updateTruck(authenticate("User1"), `{"name":"Updated truck 1"}`)
 	checkResponseCode(t, http.StatusOK, response.Code)
+}
 
-	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
-	req.Header.Set("Authorization", jwt)
-	response = executeRequest(req)
-	checkResponseCode(t, http.StatusNotFound, response.Code) 
+func TestUpdateTruckProfile(t *testing.T) {
+	clearTableTrucks()
+	jwt := getJWT()
+	addTrucks(1)
+
+	payload := `{"cell":"(512) 555-0142","address":"600 Congress Ave","city":"Austin","state":"tx","zip":"78701",
+		"cuisines":["Tex-Mex","BBQ"],"website":"https://example.com","socialLinks":{"instagram":"https://instagram.com/truck"},
+		"timezone":"America/Chicago",
+		"hours":[{"day":"mon","opens":"11:00","closes":"14:00"},{"day":"fri","opens":"20:00","closes":"02:00"}],
+		"hoursExceptions":[{"date":"2025-12-25","closed":true,"note":"Christmas"}]}`
+	response := updateTruck(jwt, payload)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	// A later update that only renames the truck keeps the rest of the profile
+	response = updateTruck(jwt, `{"name":"Renamed truck"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	truck := m["data"].(map[string]interface{})
+	if truck["name"] != "Renamed truck" || truck["cell"] != "5125550142" || truck["state"] != "TX" || truck["zip"] != "78701" {
+		t.Errorf("Expected the renamed truck to keep its normalized contact details. Got '%v'", truck)
+	}
+	if cuisines := truck["cuisines"].([]interface{}); len(cuisines) != 2 || cuisines[0] != "tex-mex" {
+		t.Errorf("Expected lowercased cuisines. Got '%v'", cuisines)
+	}
+	if truck["timezone"] != "America/Chicago" {
+		t.Errorf("Expected timezone 'America/Chicago'. Got '%v'", truck["timezone"])
+	}
+	hours := truck["hours"].([]interface{})
+	if len(hours) != 2 {
+		t.Fatalf("Expected 2 opening hours. Got '%v'", hours)
+	}
+	if late := hours[1].(map[string]interface{}); late["day"] != "fri" || late["opens"] != "20:00" || late["closes"] != "02:00" {
+		t.Errorf("Expected friday 20:00-02:00. Got '%v'", late)
+	}
+	exceptions := truck["hoursExceptions"].([]interface{})
+	if len(exceptions) != 1 || exceptions[0].(map[string]interface{})["date"] != "2025-12-25" {
+		t.Errorf("Expected the christmas closure. Got '%v'", exceptions)
+	}
+
+	// Sending a list replaces it
+	response = updateTruck(jwt, `{"hours":[]}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if hours := m["data"].(map[string]interface{})["hours"].([]interface{}); len(hours) != 0 {
+		t.Errorf("Expected the hours to be cleared. Got '%v'", hours)
+	}
+}
+
+func TestUpdateTruckProfileValidation(t *testing.T) {
+	clearTableTrucks()
+	jwt := getJWT()
+	addTrucks(1)
+
+	for _, payload := range []string{
+		`{"name":" "}`,
+		`{"cell":"555-0142"}`,
+		`{"zip":"7870"}`,
+		`{"state":"Texas"}`,
+		`{"website":"example.com"}`,
+		`{"socialLinks":{"myspace":"https://myspace.com/truck"}}`,
+		`{"timezone":"Mars/Olympus_Mons"}`,
+		`{"hours":[{"day":"mon","opens":"11:00","closes":"14:00"},{"day":"mon","opens":"13:00","closes":"15:00"}]}`,
+		`{"hours":[{"day":"someday","opens":"11:00","closes":"14:00"}]}`,
+		`{"hoursExceptions":[{"date":"12/25/2025","closed":true}]}`,
+	} {
+		response := updateTruck(jwt, payload)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected with %d. Got %d", payload, http.StatusBadRequest, response.Code)
+		}
+	}
+}
+
+// Adds a truck owned by user 1, reviewed once with each rating by customers
+// added for the purpose
+func addProfiledTruck(name, description string, cuisines []string, ratings ...int) {
+	t := database.Truck{Name: name, OwnerID: 1, Description: description, Cuisines: cuisines}
+	a.Store.CreateTruck(context.Background(), &t)
+	for i, rating := range ratings {
+		username := fmt.Sprintf("%s fan %d", name, i)
+		reviewer := database.User{Username: username, Email: username + "@test.com", Role: database.RoleCustomer}
+		a.Store.CreateUser(context.Background(), &reviewer)
+		a.Store.SaveReview(context.Background(), &database.Review{TruckID: t.ID, UserID: reviewer.ID, Rating: rating})
+	}
+}
+
+func TestSearchTrucks(t *testing.T) {
+	clearTableTrucks()
+	jwt := getJWT()
+	addProfiledTruck("Taco Loco", "Street tacos and horchata", []string{"mexican"}, 4, 5)
+	addProfiledTruck("Smoke Stack", "Brisket, ribs and tacos on Fridays", []string{"bbq"}, 3, 4)
+	addProfiledTruck("Pho Real", "Noodle soup", []string{"vietnamese"}, 5, 5)
+
+	list := func(query string) string {
+		req, _ := http.NewRequest("GET", "/api/v1/trucks?" + query, nil)
+		req.Header.Set("Authorization", jwt)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var m map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		names := []string{}
+		for _, truck := range m["data"].([]interface{}) {
+			names = append(names, truck.(map[string]interface{})["name"].(string))
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		query 	string
+		names 	string
+	}{
+		{"", "Taco Loco,Smoke Stack,Pho Real"},
+		{"q=taco", "Taco Loco,Smoke Stack"},
+		{"q=noodles", "Pho Real"},
+		{"q=tacos&cuisine=BBQ", "Smoke Stack"},
+		{"minRating=4", "Taco Loco,Pho Real"},
+		{"sort=-rating", "Pho Real,Taco Loco,Smoke Stack"},
+		{"sort=name&minRating=4", "Pho Real,Taco Loco"},
+		{"sort=name&count=2", "Pho Real,Smoke Stack"},
+	}
+	for _, test := range tests {
+		if names := list(test.query); names != test.names {
+			t.Errorf("%s: expected '%s'. Got '%s'", test.query, test.names, names)
+		}
+	}
+
+	for _, query := range []string{"sort=price", "minRating=6", "minRating=high"} {
+		req, _ := http.NewRequest("GET", "/api/v1/trucks?" + query, nil)
+		req.Header.Set("Authorization", jwt)
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	}
+}
+
+func TestDeleteTruck(t *testing.T) {
+	clearTableTrucks()
+	jwt := getJWT()
+	addTrucks(1)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code) 
+}
+
+func TestDeleteNonExistentTruck(t *testing.T) {
+	clearTableTrucks()
+	jwt := getAdminJWT()
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/truck/11", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["errorCode"] != "truck_not_found" {
+		t.Errorf("Expected the error code 'truck_not_found'. Got '%v'", m["errorCode"])
+	}
+}
+
+// Order endpoint tests
+
+func TestCreateOrder(t *testing.T) {
+	_, customerJWT := setUpOrdering()
+
+	response := placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":2},{"menuItemId":2,"quantity":1}],"notes":"no onions"}`))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	data := m["data"].(map[string]interface{})
+
+	if data["totalCents"] != 2000.0 {
+		t.Errorf("Expected the total to be 2000. Got '%v'", data["totalCents"])
+	}
+	if data["status"] != "placed" {
+		t.Errorf("Expected the status to be 'placed'. Got '%v'", data["status"])
+	}
+	if data["userId"] != 2.0 {
+		t.Errorf("Expected the order to belong to user 2. Got '%v'", data["userId"])
+	}
+	if len(data["items"].([]interface{})) != 2 {
+		t.Errorf("Expected 2 order items. Got %d", len(data["items"].([]interface{})))
+	}
+}
+
+func TestCreateOrderIgnoresClientPrices(t *testing.T) {
+	_, customerJWT := setUpOrdering()
+
+	response := placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1,"unitPriceCents":1}],"totalCents":1}`))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["totalCents"] != 850.0 {
+		t.Errorf("Expected the total to be 850. Got '%v'", m["data"].(map[string]interface{})["totalCents"])
+	}
+}
+
+func TestCreateOrderUnavailableItem(t *testing.T) {
+	_, customerJWT := setUpOrdering()
+	addMenuItem(1, "Sold out taco", 400, false)
+
+	response := placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":3,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":42,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[]}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestGetOrders(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+
+	req, _ := http.NewRequest("GET", "/api/v1/user/2/orders", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if len(m["data"].([]interface{})) != 1 {
+		t.Errorf("Expected 1 order for the customer. Got %d", len(m["data"].([]interface{})))
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1/orders", nil)
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if len(m["data"].([]interface{})) != 1 {
+		t.Errorf("Expected 1 order for the truck. Got %d", len(m["data"].([]interface{})))
+	}
+
+	// Customers can't see the truck's orders
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1/orders", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func updateOrderStatus(jwt, status string) *httptest.ResponseRecorder {
+	payload := []byte(`{"status":"` + status + `"}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/order/1", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+
+	checkResponseCode(t, http.StatusForbidden, updateOrderStatus(customerJWT, "accepted").Code)
+	checkResponseCode(t, http.StatusConflict, updateOrderStatus(ownerJWT, "ready").Code)
+	checkResponseCode(t, http.StatusBadRequest, updateOrderStatus(ownerJWT, "eaten").Code)
+
+	for _, status := range []string{"accepted", "preparing", "ready"} {
+		response := updateOrderStatus(ownerJWT, status)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var m map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		if m["data"].(map[string]interface{})["status"] != status {
+			t.Errorf("Expected the status to be '%s'. Got '%v'", status, m["data"].(map[string]interface{})["status"])
+		}
+	}
+
+	checkResponseCode(t, http.StatusConflict, updateOrderStatus(ownerJWT, "placed").Code)
+	checkResponseCode(t, http.StatusConflict, updateOrderStatus(customerJWT, "cancelled").Code)
+	checkResponseCode(t, http.StatusOK, updateOrderStatus(ownerJWT, "picked_up").Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1/order/1/history", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	history := m["data"].([]interface{})
+	if len(history) != 5 {
+		t.Fatalf("Expected 5 history entries. Got %d", len(history))
+	}
+	if history[4].(map[string]interface{})["fromStatus"] != "ready" || history[4].(map[string]interface{})["toStatus"] != "picked_up" {
+		t.Errorf("Expected the last entry to be ready to picked_up. Got '%v'", history[4])
+	}
+}
+
+func TestCustomerCancelsOrder(t *testing.T) {
+	_, customerJWT := setUpOrdering()
+	placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+
+	checkResponseCode(t, http.StatusOK, updateOrderStatus(customerJWT, "cancelled").Code)
+}
+
+func TestDeleteOrder(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/truck/1/order/1", nil)
+	req.Header.Set("Authorization", ownerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1/order/1", nil)
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestManageMenu(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+
+	payload := []byte(`{"name":"Drinks","position":2}`)
+	req, _ := http.NewRequest("POST", "/api/v1/truck/1/menu/categories", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	payload = []byte(`{"name":"Mains","position":1}`)
+	req, _ = http.NewRequest("POST", "/api/v1/truck/1/menu/categories", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	payload = []byte(`{"categoryId":2,"name":"Veggie bowl","description":"Rice, beans and salsa","priceCents":950,"dietaryTags":["Vegan","gluten-free","vegan"]}`)
+	req, _ = http.NewRequest("POST", "/api/v1/truck/1/menu/items", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	item := m["data"].(map[string]interface{})
+	if item["available"] != true {
+		t.Errorf("Expected a new item to be available. Got '%v'", item["available"])
+	}
+	if tags := item["dietaryTags"].([]interface{}); len(tags) != 2 || tags[0] != "gluten_free" || tags[1] != "vegan" {
+		t.Errorf("Expected the tags to be [gluten_free vegan]. Got '%v'", tags)
+	}
+
+	payload = []byte(`{"categoryId":1,"name":"Horchata","priceCents":350}`)
+	req, _ = http.NewRequest("PUT", "/api/v1/truck/1/menu/item/2", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1/menu", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &m)
+	menu := m["data"].(map[string]interface{})
+	categories := menu["categories"].([]interface{})
+	if len(categories) != 2 || categories[0].(map[string]interface{})["name"] != "Mains" {
+		t.Fatalf("Expected Mains then Drinks. Got '%v'", categories)
+	}
+	mains := categories[0].(map[string]interface{})["items"].([]interface{})
+	if len(mains) != 1 || mains[0].(map[string]interface{})["name"] != "Veggie bowl" {
+		t.Errorf("Expected the veggie bowl under Mains. Got '%v'", mains)
+	}
+	drinks := categories[1].(map[string]interface{})["items"].([]interface{})
+	if len(drinks) != 1 || drinks[0].(map[string]interface{})["priceCents"] != 350.0 {
+		t.Errorf("Expected the horchata at 350 under Drinks. Got '%v'", drinks)
+	}
+	if uncategorized := menu["uncategorized"].([]interface{}); len(uncategorized) != 1 {
+		t.Errorf("Expected the burrito to be uncategorized. Got '%v'", uncategorized)
+	}
+
+	payload = []byte(`{"name":"Churro","priceCents":300}`)
+	req, _ = http.NewRequest("POST", "/api/v1/truck/1/menu/items", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", customerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func TestMenuItemValidation(t *testing.T) {
+	ownerJWT, _ := setUpOrdering()
+
+	for _, payload := range []string{
+		`{"name":"Churro"}`,
+		`{"name":"Churro","priceCents":-1}`,
+		`{"name":"Churro","priceCents":300,"dietaryTags":["paleo"]}`,
+		`{"name":"Churro","priceCents":300,"categoryId":7}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/v1/truck/1/menu/items", bytes.NewBuffer([]byte(payload)))
+		req.Header.Set("Authorization", ownerJWT)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestMenuItemAvailability(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+
+	payload := []byte(`{"available":false}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/menu/item/1/availability", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1/menu/item/1", nil)
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/truck/1/menu/item/1/availability", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+// Gives the burrito (item 1) a required protein choice (options 1 and 2) and
+// optional extras (options 3 and 4)
+func addBurritoOptions(t *testing.T, ownerJWT string) {
+	for _, payload := range []string{
+		`{"name":"Protein","minSelections":1,"maxSelections":1,"options":[{"name":"Carnitas"},{"name":"Steak","priceDeltaCents":150}]}`,
+		`{"name":"Extras","minSelections":0,"maxSelections":2,"position":1,"options":[{"name":"Guac","priceDeltaCents":100},{"name":"Queso","priceDeltaCents":75}]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/v1/truck/1/menu/item/1/option-groups", bytes.NewBuffer([]byte(payload)))
+		req.Header.Set("Authorization", ownerJWT)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusCreated, response.Code)
+	}
+}
+
+func TestOrderWithOptions(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addBurritoOptions(t, ownerJWT)
+
+	response := placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1,"options":[1,2]}]}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":2,"options":[2,3]},{"menuItemId":2,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	order := m["data"].(map[string]interface{})
+	if order["totalCents"] != 2500.0 {
+		t.Errorf("Expected a total of 2500. Got '%v'", order["totalCents"])
+	}
+	line := order["items"].([]interface{})[0].(map[string]interface{})
+	if line["unitPriceCents"] != 1100.0 {
+		t.Errorf("Expected a unit price of 1100. Got '%v'", line["unitPriceCents"])
+	}
+	if options := line["options"].([]interface{}); len(options) != 2 || options[0].(map[string]interface{})["name"] != "Steak" {
+		t.Errorf("Expected Steak and Guac on the line. Got '%v'", options)
+	}
+}
+
+func TestUpdateOptionGroup(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addBurritoOptions(t, ownerJWT)
+
+	payload := []byte(`{"name":"Protein","minSelections":1,"maxSelections":1,"options":[{"id":1,"name":"Carnitas"},{"id":2,"name":"Steak","priceDeltaCents":200,"available":false}]}`)
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/menu/item/1/option-group/1", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	response = placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1,"options":[2]}]}`))
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	payload = []byte(`{"name":"Protein","minSelections":2,"maxSelections":1,"options":[{"name":"Tofu"}]}`)
+	req, _ = http.NewRequest("PUT", "/api/v1/truck/1/menu/item/1/option-group/1", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1/menu", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	burrito := m["data"].(map[string]interface{})["uncategorized"].([]interface{})[0].(map[string]interface{})
+	groups := burrito["optionGroups"].([]interface{})
+	if len(groups) != 2 || groups[0].(map[string]interface{})["required"] != true {
+		t.Errorf("Expected a required Protein group then Extras. Got '%v'", groups)
+	}
+}
+
+func updateTruckLocation(jwt string, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/location", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func TestTruckLocation(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	hourAgo := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	twoHoursAgo := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+
+	checkResponseCode(t, http.StatusForbidden, updateTruckLocation(customerJWT, `{"lat":30.2672,"lng":-97.7431}`).Code)
+	checkResponseCode(t, http.StatusBadRequest, updateTruckLocation(ownerJWT, `{"lat":91,"lng":-97.7431}`).Code)
+	checkResponseCode(t, http.StatusBadRequest, updateTruckLocation(ownerJWT, `{"lat":30.2672}`).Code)
+
+	response := updateTruckLocation(ownerJWT, `{"lat":30.25,"lng":-97.75,"recordedAt":"` + hourAgo + `"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	location := m["data"].(map[string]interface{})["location"].(map[string]interface{})
+	if location["stale"] != true {
+		t.Errorf("Expected an hour old location to be stale. Got '%v'", location)
+	}
+
+	response = updateTruckLocation(ownerJWT, `{"lat":30.2672,"lng":-97.7431,"accuracy":12.5}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	response = updateTruckLocation(ownerJWT, `{"lat":30.1,"lng":-97.9,"recordedAt":"` + twoHoursAgo + `"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &m)
+	location = m["data"].(map[string]interface{})["location"].(map[string]interface{})
+	if location["lat"] != 30.2672 || location["accuracy"] != 12.5 || location["stale"] != false {
+		t.Errorf("Expected the newest report to stay current. Got '%v'", location)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1/locations", nil)
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if history := m["data"].([]interface{}); len(history) != 3 {
+		t.Errorf("Expected 3 reports in the history. Got %d", len(history))
+	}
+}
+
+func setTruckLocation(id int, lat, lng float64, recordedAt time.Time) {
+	t := database.Truck{ID: id}
+	a.Store.RecordLocation(context.Background(), &t, database.Location{Latitude: lat, Longitude: lng, RecordedAt: recordedAt})
+}
+
+func TestTrucksNearby(t *testing.T) {
+	_, customerJWT := setUpOrdering()
+	addTrucks(3)
+	setTruckLocation(1, 30.2672, -97.7431, time.Now())
+	setTruckLocation(2, 30.2849, -97.7341, time.Now())
+	setTruckLocation(3, 30.2680, -97.7440, time.Now().Add(-time.Hour))
+	setTruckLocation(4, 32.7767, -96.7970, time.Now())
+
+	nearby := func(query string) []interface{} {
+		req, _ := http.NewRequest("GET", "/api/v1/trucks/nearby?" + query, nil)
+		req.Header.Set("Authorization", customerJWT)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var m map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		return m["data"].([]interface{})
+	}
+
+	trucks := nearby("lat=30.2672&lng=-97.7431&radius=3000")
+	if len(trucks) != 2 {
+		t.Fatalf("Expected 2 trucks within 3 km. Got %d", len(trucks))
+	}
+	first, second := trucks[0].(map[string]interface{}), trucks[1].(map[string]interface{})
+	if first["id"] != 1.0 || first["distanceMeters"] != 0.0 {
+		t.Errorf("Expected truck 1 first at 0 m. Got '%v'", first)
+	}
+	if d := second["distanceMeters"].(float64); second["id"] != 2.0 || d < 2000 || d > 2300 {
+		t.Errorf("Expected truck 2 about 2.1 km away. Got '%v'", second)
+	}
+
+	if trucks := nearby("lat=30.2672&lng=-97.7431&radius=1000"); len(trucks) != 1 {
+		t.Errorf("Expected 1 truck within 1 km. Got %d", len(trucks))
+	}
+
+	for _, query := range []string{"lng=-97.7431", "lat=30.2672&lng=-197", "lat=30.2672&lng=-97.7431&radius=0", "lat=30.2672&lng=-97.7431&radius=far"} {
+		req, _ := http.NewRequest("GET", "/api/v1/trucks/nearby?" + query, nil)
+		req.Header.Set("Authorization", customerJWT)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+}
+
+func addScheduleEntry(jwt, path, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/v1/truck/1/schedule/" + path, bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func TestTruckSchedule(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+
+	slot := `{"day":"mon","starts":"11:00","ends":"14:00","lat":30.2672,"lng":-97.7431,"address":"600 Congress Ave"}`
+	checkResponseCode(t, http.StatusForbidden, addScheduleEntry(customerJWT, "slots", slot).Code)
+	checkResponseCode(t, http.StatusCreated, addScheduleEntry(ownerJWT, "slots", slot).Code)
+	checkResponseCode(t, http.StatusConflict, addScheduleEntry(ownerJWT, "slots", `{"day":"mon","starts":"13:00","ends":"15:00","lat":30.2672,"lng":-97.7431}`).Code)
+	checkResponseCode(t, http.StatusBadRequest, addScheduleEntry(ownerJWT, "slots", `{"day":"mon","starts":"16:00","ends":"18:00"}`).Code)
+
+	past := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	checkResponseCode(t, http.StatusBadRequest, addScheduleEntry(ownerJWT, "events", `{"name":"Festival","startsAt":"` + past + `","endsAt":"` + past + `","lat":30.26,"lng":-97.74}`).Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1/schedule", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	slots := m["data"].(map[string]interface{})["slots"].([]interface{})
+	if len(slots) != 1 || slots[0].(map[string]interface{})["starts"] != "11:00" {
+		t.Errorf("Expected the monday slot. Got '%v'", slots)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["nextOpening"] == nil {
+		t.Errorf("Expected a next opening from the weekly slot. Got '%v'", m["data"])
+	}
+}
+
+func TestTrucksOpenNow(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addTrucks(1)
+
+	startsAt := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	endsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	response := addScheduleEntry(ownerJWT, "events", `{"name":"Farmers market","startsAt":"` + startsAt + `","endsAt":"` + endsAt + `","lat":30.26,"lng":-97.74}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/trucks?openNow=true", nil)
+	req.Header.Set("Authorization", customerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	trucks := m["data"].([]interface{})
+	if len(trucks) != 1 || trucks[0].(map[string]interface{})["id"] != 1.0 || trucks[0].(map[string]interface{})["isOpen"] != true {
+		t.Errorf("Expected only truck 1 to be open. Got '%v'", trucks)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/trucks?openNow=maybe", nil)
+	req.Header.Set("Authorization", customerJWT)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+// Review tests
+
+func saveReview(jwt, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/review", bytes.NewBufferString(payload))
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+// Returns the rating and rating count of truck 1
+func truckRating(jwt string) (float64, float64) {
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", jwt)
+	response := executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	truck := m["data"].(map[string]interface{})
+	return truck["rating"].(float64), truck["ratingCount"].(float64)
+}
+
+func TestReviews(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addUser("User2", database.RoleCustomer)
+	otherJWT := authenticate("User2")
+
+	placeOrder(customerJWT, []byte(`{"items":[{"menuItemId":1,"quantity":1}]}`))
+	checkResponseCode(t, http.StatusBadRequest, saveReview(customerJWT, `{"rating":4,"orderId":1}`).Code)
+	for _, status := range []string{"accepted", "preparing", "ready", "picked_up"} {
+		updateOrderStatus(ownerJWT, status)
+	}
+
+	checkResponseCode(t, http.StatusForbidden, saveReview(ownerJWT, `{"rating":5}`).Code)
+	checkResponseCode(t, http.StatusBadRequest, saveReview(customerJWT, `{"rating":6}`).Code)
+	checkResponseCode(t, http.StatusBadRequest, saveReview(otherJWT, `{"rating":1,"orderId":1}`).Code)
+
+	response := saveReview(customerJWT, `{"rating":4,"body":"Great burritos","orderId":1}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["verifiedPurchase"] != true {
+		t.Errorf("Expected the review to be a verified purchase. Got '%v'", m["data"])
+	}
+
+	checkResponseCode(t, http.StatusCreated, saveReview(otherJWT, `{"rating":2,"body":"Too spicy"}`).Code)
+	if rating, count := truckRating(customerJWT); rating != 3 || count != 2 {
+		t.Errorf("Expected a rating of 3 from 2 reviews. Got %v from %v", rating, count)
+	}
+
+	// Saving again edits the customer's review instead of adding one
+	checkResponseCode(t, http.StatusOK, saveReview(customerJWT, `{"rating":5,"body":"Even better the second time"}`).Code)
+	if rating, count := truckRating(customerJWT); rating != 3.5 || count != 2 {
+		t.Errorf("Expected a rating of 3.5 from 2 reviews. Got %v from %v", rating, count)
+	}
+
+	req, _ := http.NewRequest("PUT", "/api/v1/truck/1/review/2/reply", bytes.NewBufferString(`{"reply":"We have a mild salsa too"}`))
+	req.Header.Set("Authorization", customerJWT)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/truck/1/review/2/reply", bytes.NewBufferString(`{"reply":"We have a mild salsa too"}`))
+	req.Header.Set("Authorization", ownerJWT)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["reply"] != "We have a mild salsa too" || m["data"].(map[string]interface{})["repliedAt"] == nil {
+		t.Errorf("Expected the owner's reply. Got '%v'", m["data"])
+	}
+
+	ids, paging := getPage(t, customerJWT, "/api/v1/truck/1/reviews?count=1")
+	if len(ids) != 1 || ids[0] != 2 || paging["next"] == nil {
+		t.Errorf("Expected the newest review and a next cursor. Got %v, '%v'", ids, paging)
+	}
+	ids, _ = getPage(t, customerJWT, "/api/v1/truck/1/reviews?count=1&cursor=" + paging["next"].(string))
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected the first review on the second page. Got %v", ids)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1/review/1", nil)
+	req.Header.Set("Authorization", otherJWT)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/truck/1/review/1", nil)
+	req.Header.Set("Authorization", customerJWT)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if rating, count := truckRating(customerJWT); rating != 2 || count != 1 {
+		t.Errorf("Expected a rating of 2 from 1 review. Got %v from %v", rating, count)
+	}
+}
+
+func TestReviewsOfDeletedUser(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addUser("User2", database.RoleCustomer)
+	otherJWT := authenticate("User2")
+
+	checkResponseCode(t, http.StatusCreated, saveReview(customerJWT, `{"rating":4}`).Code)
+	checkResponseCode(t, http.StatusCreated, saveReview(otherJWT, `{"rating":2}`).Code)
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/user/2", nil)
+	req.Header.Set("Authorization", customerJWT)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	// The deleted user's review no longer counts towards the rating
+	if rating, count := truckRating(ownerJWT); rating != 2 || count != 1 {
+		t.Errorf("Expected a rating of 2 from 1 review. Got %v from %v", rating, count)
+	}
+}
+
+// Favorite tests
+
+func favorite(method, jwt, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/api/v1/user/" + path, nil)
+	req.Header.Set("Authorization", jwt)
+	return executeRequest(req)
+}
+
+func TestFavorites(t *testing.T) {
+	ownerJWT, customerJWT := setUpOrdering()
+	addTrucks(1)
+
+	checkResponseCode(t, http.StatusCreated, favorite("POST", customerJWT, "2/favorites/1").Code)
+	response := favorite("POST", customerJWT, "2/favorites/1")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["favoriteCount"] != 1.0 {
+		t.Errorf("Expected a favorite count of 1. Got '%v'", m["data"].(map[string]interface{})["favoriteCount"])
+	}
+
+	checkResponseCode(t, http.StatusCreated, favorite("POST", customerJWT, "2/favorites/2").Code)
+	checkResponseCode(t, http.StatusCreated, favorite("POST", ownerJWT, "1/favorites/1").Code)
+	checkResponseCode(t, http.StatusForbidden, favorite("POST", customerJWT, "1/favorites/2").Code)
+	checkResponseCode(t, http.StatusNotFound, favorite("POST", customerJWT, "2/favorites/9").Code)
+
+	ids, _ := getPage(t, customerJWT, "/api/v1/user/2/favorites")
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Errorf("Expected trucks 2 and 1, most recent first. Got %v", ids)
+	}
+	checkResponseCode(t, http.StatusForbidden, favorite("GET", customerJWT, "1/favorites").Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/truck/1", nil)
+	req.Header.Set("Authorization", customerJWT)
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+	if m["data"].(map[string]interface{})["favoriteCount"] != 2.0 {
+		t.Errorf("Expected a favorite count of 2. Got '%v'", m["data"].(map[string]interface{})["favoriteCount"])
+	}
+
+	checkResponseCode(t, http.StatusOK, favorite("DELETE", customerJWT, "2/favorites/1").Code)
+	checkResponseCode(t, http.StatusNotFound, favorite("DELETE", customerJWT, "2/favorites/1").Code)
+	ids, _ = getPage(t, customerJWT, "/api/v1/user/2/favorites")
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Expected only truck 2. Got %v", ids)
+	}
 }